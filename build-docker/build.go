@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"path"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/upfluence/errors"
 	"github.com/upfluence/log"
 	"github.com/upfluence/log/record"
 
 	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/oci"
 	"github.com/upfluence/actions/pkg/toolkit"
 )
 
@@ -18,6 +24,9 @@ var defaultConfig = config{
 	OS:              "linux",
 	Arch:            "amd64",
 	Registries:      []string{"index.docker.io"},
+	Pull:            true,
+	Parallelism:     2,
+	CacheMode:       maxCacheMode,
 }
 
 const (
@@ -48,40 +57,19 @@ func (am argMode) args(cctx toolkit.CommandContext, v string) map[string]string
 			"GIT_COMMIT":     cctx.Sha,
 			"GIT_REMOTE":     "https://github.com/" + cctx.Repository,
 			"SEMVER_VERSION": v,
-			"GITHUB_TOKEN":   cctx.Token,
 		}
 	default:
 		return make(map[string]string)
 	}
 }
 
-type tagMode int
-
-func (tm *tagMode) Parse(v string) error {
-	switch v {
-	case "app":
-		*tm = app
-	case "none":
-		*tm = none
-	default:
-		return fmt.Errorf("Invalid tag-mode %q", v)
-	}
-
-	return nil
-}
-
-func (tm tagMode) tags(cctx toolkit.CommandContext, v string) []string {
-	switch tm {
+// secrets maps the secret ids to the env vars they are read from.
+func (am argMode) secrets() map[string]string {
+	switch am {
 	case app:
-		upstream := cctx.RefName
-
-		if upstream == "master" || upstream == "main" {
-			upstream = "latest"
-		}
-
-		return []string{v, upstream, cctx.Sha[:7]}
+		return map[string]string{"GITHUB_TOKEN": "GITHUB_TOKEN"}
 	default:
-		return nil
+		return make(map[string]string)
 	}
 }
 
@@ -94,15 +82,42 @@ type config struct {
 	ArgMode        argMode           `flag:"arg-mode"`
 	AdditionalArgs map[string]string `flag:"additional-args"`
 
+	Secrets         map[string]string `flag:"secrets"`
+	SSH             []string          `flag:"ssh"`
+	SecretArgPolicy secretArgPolicy   `flag:"secret-args"`
+
 	OS   string `flag:"os"`
 	Arch string `flag:"arch"`
 
-	TagMode        tagMode  `flag:"tag-mode"`
-	AdditionalTags []string `flag:"additional-tags"`
+	Platforms         []string          `flag:"platforms"`
+	MultiPlatformMode multiPlatformMode `flag:"multi-platform-mode"`
 
-	SkipPush bool `flag:"skip-push"`
+	TagMode        tagMode       `flag:"tag-mode"`
+	TagTemplates   []tagTemplate `flag:"tag-templates"`
+	FloatingTags   bool          `flag:"floating-tags"`
+	AdditionalTags []string      `flag:"additional-tags"`
+
+	SkipPush    bool `flag:"skip-push"`
+	Pull        bool `flag:"pull"`
+	Parallelism int  `flag:"parallelism"`
+
+	CacheType     cacheType   `flag:"cache-type"`
+	CacheRef      refTemplate `flag:"cache-ref"`
+	CacheMode     cacheMode   `flag:"cache-mode"`
+	DefaultBranch string      `flag:"default-branch"`
+
+	RegistryUsername        string   `flag:"registry-username"`
+	RegistryPassword        string   `env:"REGISTRY_PASSWORD"`
+	RegistryCredentialsFile string   `flag:"registry-credentials-file"`
+	LoginRegistries         []string `flag:"login-registries"`
+	ECREndpoint             string   `flag:"ecr-endpoint"`
 
 	OverrideRepositories map[string]string `flag:"override-repositories"`
+
+	Labels map[string]string `flag:"labels"`
+
+	BuildManifest      string `flag:"build-manifest"`
+	DockerfileSettings string `flag:"dockerfile-settings"`
 }
 
 func (c *config) repository(n string) string {
@@ -113,15 +128,36 @@ func (c *config) repository(n string) string {
 	return n
 }
 
-func (c *config) platform() string {
-	return fmt.Sprintf("%s/%s", c.OS, c.Arch)
+// platforms returns the platforms to build, Platforms takes precedence over
+// OS and Arch.
+func (c *config) platforms() ([]oci.Platform, error) {
+	vs := c.Platforms
+
+	if len(vs) == 0 {
+		vs = []string{fmt.Sprintf("%s/%s", c.OS, c.Arch)}
+	}
+
+	return parsePlatforms(vs)
 }
 
-func (c *config) tags(cctx toolkit.CommandContext) []string {
-	return append(
-		c.TagMode.tags(cctx, c.Version),
-		c.AdditionalTags...,
-	)
+func parsePlatforms(vs []string) ([]oci.Platform, error) {
+	ps := make([]oci.Platform, 0, len(vs))
+
+	for _, v := range vs {
+		p, err := oci.ParsePlatform(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if slices.Contains(ps, p) {
+			continue
+		}
+
+		ps = append(ps, p)
+	}
+
+	return ps, nil
 }
 
 func (c *config) args(cctx toolkit.CommandContext) map[string]string {
@@ -142,15 +178,54 @@ func (c *config) executor(l log.Logger) executil.Executor {
 	}
 }
 
-func (c *config) builds(cctx toolkit.CommandContext) ([]build, error) {
+func (c *config) builds(ctx context.Context, cctx toolkit.CommandContext) ([]build, error) {
 	var (
 		bs []build
 
-		tags     = c.tags(cctx)
-		platform = c.platform()
-		args     = c.args(cctx)
+		args    = c.args(cctx)
+		secrets = c.secrets()
 	)
 
+	floating, err := c.floatingTags(ctx, cctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	tags, err := c.tags(newTagContext(cctx, c.Version, now), floating...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkSecretArgs(cctx.Logger, args, secrets, cctx.Token); err != nil {
+		return nil, err
+	}
+
+	platforms, err := c.platforms()
+
+	if err != nil {
+		return nil, err
+	}
+
+	co, err := c.cacheOptions(cctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	labels := c.labels(ctx, cctx, now)
+
+	ss, err := c.dockerfileSettings()
+
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]bool, len(ss))
+
 	for _, p := range c.DockerfilePaths {
 		fnames, err := filepath.Glob(filepath.Join(".", p))
 
@@ -166,18 +241,100 @@ func (c *config) builds(cctx toolkit.CommandContext) ([]build, error) {
 				name += "/" + filepath.Base(filepath.Dir(fname))
 			}
 
-			bs = append(
-				bs,
-				build{
-					name:       c.repository(name),
-					dockerfile: fname,
-					platform:   platform,
-					commit:     cctx.Sha[:7],
-					registries: c.Registries,
-					tags:       tags,
-					args:       args,
-				},
-			)
+			s, err := settingsFor(ss, fname, matched)
+
+			if err != nil {
+				return nil, err
+			}
+
+			b := build{
+				name:       c.repository(name),
+				dockerfile: fname,
+				context:    ".",
+				target:     s.Target,
+				platforms:  platforms,
+				commit:     cctx.Sha[:7],
+				registries: c.Registries,
+				tags:       tags,
+				args:       args,
+				secrets:    secrets,
+				ssh:        c.SSH,
+				pull:       c.Pull,
+				labels:     maps.Clone(labels),
+				cache:      make(map[string][]string),
+			}
+
+			if s.Name != "" {
+				b.name = s.Name
+			}
+
+			if s.Context != "" {
+				b.context = filepath.Clean(s.Context)
+			}
+
+			if len(s.Args) > 0 {
+				if err := c.checkSecretArgs(cctx.Logger, s.Args, secrets, cctx.Token); err != nil {
+					return nil, err
+				}
+
+				b.args = maps.Clone(args)
+				maps.Copy(b.args, s.Args)
+			}
+
+			if len(s.Platforms) > 0 {
+				if b.platforms, err = parsePlatforms(s.Platforms); err != nil {
+					return nil, errors.Wrapf(err, "invalid platforms of %s", fname)
+				}
+			}
+
+			ignore, err := buildContext(cctx.Logger, b.context, fname)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if ignore != "" {
+				cctx.Logger.Infof("%s is built out of %s, ignoring the files listed in %s", fname, b.context, ignore)
+			}
+
+			b.labels[oci.AnnotationTitle] = path.Base(b.name)
+			maps.Copy(b.labels, c.Labels)
+
+			keys := []string{""}
+
+			if b.multiPlatform() && c.MultiPlatformMode == index {
+				keys = nil
+
+				for _, p := range b.platforms {
+					keys = append(keys, p.String())
+				}
+			}
+
+			for _, k := range keys {
+				if b.cache[k], err = co.flags(b, k); err != nil {
+					return nil, err
+				}
+			}
+
+			bs = append(bs, b)
+		}
+	}
+
+	for i, s := range ss {
+		if !matched[i] {
+			cctx.Logger.Warningf("The settings of %s match none of the dockerfiles built", s.Dockerfile)
+		}
+	}
+
+	if err := resolveDependencies(bs); err != nil {
+		return nil, err
+	}
+
+	for i, b := range bs {
+		if len(b.deps) > 0 && c.SkipPush && b.pull {
+			// the images built in this run are only in the docker daemon
+			cctx.Logger.Noticef("Not pulling the base images of %s, it depends on local images", b.dockerfile)
+			bs[i].pull = false
 		}
 	}
 
@@ -187,69 +344,125 @@ func (c *config) builds(cctx toolkit.CommandContext) ([]build, error) {
 type build struct {
 	name       string
 	dockerfile string
+	context    string
+	target     string
 	args       map[string]string
-	platform   string
+	secrets    []secret
+	ssh        []string
+	pull       bool
+	labels     map[string]string
+	platforms  []oci.Platform
 	commit     string
 
 	registries []string
 	tags       []string
+
+	// cache holds the cache flags of the build, keyed by platform when each
+	// platform is built on its own.
+	cache map[string][]string
+
+	// deps are the indexes of the builds producing the images this one is
+	// built from.
+	deps []int
 }
 
 func (b build) intermediateTag() string {
 	return fmt.Sprintf("%s:%s", b.name, b.commit)
 }
 
+func (b build) multiPlatform() bool { return len(b.platforms) > 1 }
+
+// buildFlags are the target, pull, build args, labels, secrets, ssh agents
+// and cache flags shared by docker build and docker buildx build.
+func (b build) buildFlags(platform string) []string {
+	var vs []string
+
+	if b.target != "" {
+		vs = append(vs, "--target", b.target)
+	}
+
+	if b.pull {
+		vs = append(vs, "--pull")
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(b.args)) {
+		vs = append(vs, "--build-arg", fmt.Sprintf("%s=%s", k, b.args[k]))
+	}
+
+	vs = append(vs, b.labelFlags()...)
+
+	for _, s := range b.secrets {
+		vs = append(vs, "--secret", s.flag())
+	}
+
+	for _, s := range b.ssh {
+		vs = append(vs, "--ssh", s)
+	}
+
+	return append(vs, b.cache[platform]...)
+}
+
 func (b build) buildArgs() []string {
+	return b.platformBuildArgs(b.platforms[0], b.intermediateTag())
+}
+
+func (b build) platformBuildArgs(p oci.Platform, tag string) []string {
 	vs := []string{
 		"build",
-		"--pull",
 		"--file",
 		b.dockerfile,
 		"--tag",
-		b.intermediateTag(),
+		tag,
 		"--platform",
-		b.platform,
+		p.String(),
 	}
 
-	for k, v := range b.args {
-		vs = append(vs, "--build-arg", fmt.Sprintf("%s=%s", k, v))
+	var key string
+
+	if b.multiPlatform() {
+		key = p.String()
 	}
 
-	return append(vs, ".")
+	vs = append(vs, b.buildFlags(key)...)
+
+	return append(vs, b.context)
 }
 
-func (b build) tagArgs() [][]string {
-	var as [][]string
+func (b build) references(tags []string) []string {
+	var vs []string
 
 	for _, r := range b.registries {
-		for _, t := range b.tags {
-			as = append(
-				as,
-				[]string{
-					"tag",
-					b.intermediateTag(),
-					fmt.Sprintf("%s/%s:%s", r, b.name, t),
-				},
-			)
+		for _, t := range tags {
+			vs = append(vs, fmt.Sprintf("%s/%s:%s", r, b.name, t))
 		}
 	}
 
+	return vs
+}
+
+func (b build) tagArgs() [][]string {
+	return b.retagArgs(b.intermediateTag(), b.tags)
+}
+
+func (b build) retagArgs(src string, tags []string) [][]string {
+	var as [][]string
+
+	for _, ref := range b.references(tags) {
+		as = append(as, []string{"tag", src, ref})
+	}
+
 	return as
 }
 
 func (b build) pushArgs() [][]string {
+	return b.repushArgs(b.tags)
+}
+
+func (b build) repushArgs(tags []string) [][]string {
 	var as [][]string
 
-	for _, r := range b.registries {
-		for _, t := range b.tags {
-			as = append(
-				as,
-				[]string{
-					"push",
-					fmt.Sprintf("%s/%s:%s", r, b.name, t),
-				},
-			)
-		}
+	for _, ref := range b.references(tags) {
+		as = append(as, []string{"push", ref})
 	}
 
 	return as
@@ -259,50 +472,84 @@ func main() {
 	toolkit.NewApp(
 		"build-docker",
 		func(ctx context.Context, cctx toolkit.CommandContext, c config) error {
-			bs, err := c.builds(cctx)
+			bs, err := c.builds(ctx, cctx)
 
 			if err != nil {
 				return err
 			}
 
-			exc := c.executor(cctx.Logger)
-
-			exec := func(args []string) error {
-				return errors.Wrap(
-					exc.Exec(
-						ctx,
-						executil.Command{
-							Cmd:    "docker",
-							Args:   args,
-							Stdout: cctx.CommandContext.Stdout,
-							Stderr: cctx.CommandContext.Stderr,
-						},
-					),
-					"cant exec docker command",
-				)
+			bd := builder{
+				executor: c.executor(cctx.Logger),
+				mode:     c.MultiPlatformMode,
+				skipPush: c.SkipPush,
+				logger:   cctx.Logger,
+				stdout:   cctx.CommandContext.Stdout,
+				stderr:   cctx.CommandContext.Stderr,
 			}
 
-			for _, b := range bs {
-				if err := exec(b.buildArgs()); err != nil {
+			if !c.SkipPush {
+				ls, err := c.logins(ctx, cctx)
+
+				if err != nil {
 					return err
 				}
 
-				for _, args := range b.tagArgs() {
-					if err := exec(args); err != nil {
-						return err
-					}
+				s, err := bd.login(ctx, ls)
+
+				if err != nil {
+					return err
 				}
 
-				if !c.SkipPush {
-					for _, args := range b.pushArgs() {
-						if err := exec(args); err != nil {
-							return err
-						}
+				defer func() {
+					if err := bd.logout(s); err != nil {
+						cctx.Logger.Warningf("Cant clean up the registry logins: %v", err)
 					}
+				}()
+
+				dir, err := oci.DockerConfigDir()
+
+				if err != nil {
+					return err
+				}
+
+				if s != nil {
+					dir = s.dir
+				}
+
+				dc, err := oci.LoadDockerConfig(dir)
+
+				if err != nil {
+					return err
 				}
+
+				bd.client = &oci.Client{Keychain: dc}
+			}
+
+			imgs, err := bd.buildAll(ctx, bs, c.Parallelism)
+
+			if err != nil {
+				return err
+			}
+
+			buf, err := json.Marshal(imgs)
+
+			if err != nil {
+				return err
+			}
+
+			cctx.Logger.Noticef("Images: %s", string(buf))
+
+			if err := cctx.Output.WriteKeyValue("images", string(buf)); err != nil {
+				return err
+			}
+
+			var primary string
+
+			if len(imgs) > 0 {
+				primary = imgs[0].reference()
 			}
 
-			return nil
+			return cctx.Output.WriteKeyValue("primary-image", primary)
 		},
 		toolkit.WithDefaultConfig(defaultConfig),
 	).Run(context.Background())
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/upfluence/log/logtest"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/executil/executiltest"
+	"github.com/upfluence/actions/pkg/oci"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+type dockerHandlers map[string]func(executil.Command) error
+
+// fakeDocker runs the handler keyed by the docker subcommand, the other
+// commands succeed silently.
+func fakeDocker(hs dockerHandlers) *executiltest.Executor {
+	return &executiltest.Executor{
+		ExecFunc: func(_ context.Context, cmd executil.Command) error {
+			if h, ok := hs[cmd.Args[0]]; ok {
+				return h(cmd)
+			}
+
+			return nil
+		},
+	}
+}
+
+func testBuilder(t testing.TB, exc executil.Executor) builder {
+	return builder{executor: exc, logger: logtest.WrapTestingLogger(t)}
+}
+
+func argsOf(exc *executiltest.Executor) [][]string {
+	var args [][]string
+
+	for _, cmd := range exc.Commands() {
+		args = append(args, cmd.Args)
+	}
+
+	return args
+}
+
+// fakeRegistry serves the manifests of a single repository without
+// authentication.
+type fakeRegistry struct {
+	mu sync.Mutex
+
+	manifests map[string][]byte
+	types     map[string]string
+}
+
+func (fr *fakeRegistry) put(ref, mt string, buf []byte) {
+	fr.manifests[ref] = buf
+	fr.types[ref] = mt
+	fr.manifests[oci.DigestOf(buf).String()] = buf
+	fr.types[oci.DigestOf(buf).String()] = mt
+}
+
+func (fr *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	ref := strings.TrimPrefix(r.URL.Path, "/v2/upfluence/foo/manifests/")
+
+	switch r.Method {
+	case http.MethodGet:
+		buf, ok := fr.manifests[ref]
+
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", fr.types[ref])
+		w.Write(buf)
+	case http.MethodPut:
+		buf, _ := io.ReadAll(r.Body)
+
+		fr.put(ref, r.Header.Get("Content-Type"), buf)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestConfigPlatforms(t *testing.T) {
+	ps, err := (&config{OS: "linux", Arch: "amd64"}).platforms()
+	require.NoError(t, err)
+	assert.Equal(t, []oci.Platform{{OS: "linux", Architecture: "amd64"}}, ps)
+
+	ps, err = (&config{
+		OS:        "linux",
+		Arch:      "amd64",
+		Platforms: []string{"linux/arm64", "linux/arm/v7", "linux/arm64"},
+	}).platforms()
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]oci.Platform{
+			{OS: "linux", Architecture: "arm64"},
+			{OS: "linux", Architecture: "arm", Variant: "v7"},
+		},
+		ps,
+	)
+
+	_, err = (&config{Platforms: []string{"linux"}}).platforms()
+	assert.Error(t, err)
+}
+
+func TestConfigSecrets(t *testing.T) {
+	var (
+		l = logtest.WrapTestingLogger(t)
+
+		c = config{
+			ArgMode:        app,
+			AdditionalArgs: map[string]string{"FOO": "bar"},
+			Secrets:        map[string]string{"npm": "NPM_TOKEN"},
+		}
+	)
+
+	ss := c.secrets()
+
+	assert.Equal(
+		t,
+		[]secret{{id: "GITHUB_TOKEN", env: "GITHUB_TOKEN"}, {id: "npm", env: "NPM_TOKEN"}},
+		ss,
+	)
+
+	args := c.args(toolkit.CommandContext{Sha: "0123456789", Token: "ghs_xxx"})
+
+	assert.NotContains(t, args, "GITHUB_TOKEN")
+	assert.NoError(t, c.checkSecretArgs(l, args, ss, "ghs_xxx"))
+
+	c.SecretArgPolicy = failSecretArg
+
+	for _, args := range []map[string]string{
+		{"NPM_TOKEN": "x"},
+		{"GITHUB_TOKEN": "x"},
+		{"TOKEN": "ghs_xxx"},
+	} {
+		assert.ErrorContains(t, c.checkSecretArgs(l, args, ss, "ghs_xxx"), "use secrets instead")
+	}
+
+	c.SecretArgPolicy = warnSecretArg
+	assert.NoError(t, c.checkSecretArgs(l, map[string]string{"GH_TOKEN": "x"}, ss, ""))
+}
+
+func TestBuildxArgs(t *testing.T) {
+	b := build{
+		name:       "upfluence/foo",
+		dockerfile: "images/foo/Dockerfile",
+		context:    "images/foo",
+		target:     "release",
+		args:       map[string]string{"B": "2", "A": "1"},
+		secrets:    []secret{{id: "GITHUB_TOKEN", env: "GITHUB_TOKEN"}},
+		ssh:        []string{"default"},
+		pull:       true,
+		labels:     map[string]string{oci.AnnotationTitle: "foo"},
+		platforms: []oci.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm64"},
+		},
+		registries: []string{"index.docker.io", "ghcr.io"},
+		tags:       []string{"v1.0.0", "latest"},
+	}
+
+	assert.Equal(
+		t,
+		[]string{
+			"buildx", "build", "--file", "images/foo/Dockerfile",
+			"--platform", "linux/amd64,linux/arm64",
+			"--tag", "index.docker.io/upfluence/foo:v1.0.0",
+			"--tag", "index.docker.io/upfluence/foo:latest",
+			"--tag", "ghcr.io/upfluence/foo:v1.0.0",
+			"--tag", "ghcr.io/upfluence/foo:latest",
+			"--target", "release",
+			"--pull",
+			"--build-arg", "A=1",
+			"--build-arg", "B=2",
+			"--label", "org.opencontainers.image.title=foo",
+			"--secret", "id=GITHUB_TOKEN,env=GITHUB_TOKEN",
+			"--ssh", "default",
+			"--annotation", "index:org.opencontainers.image.title=foo",
+			"--annotation", "manifest:org.opencontainers.image.title=foo",
+			"--push",
+			"--metadata-file", "metadata.json",
+			"images/foo",
+		},
+		b.buildxArgs(true, "metadata.json"),
+	)
+
+	b.tags = nil
+	assert.NotContains(t, b.buildxArgs(true, ""), "--push")
+}
+
+func TestBuilderSingle(t *testing.T) {
+	var (
+		digest = oci.DigestOf([]byte("manifest"))
+
+		exc = fakeDocker(
+			dockerHandlers{
+				"push": func(cmd executil.Command) error {
+					_, tag, _ := strings.Cut(cmd.Args[1], ":")
+					_, err := fmt.Fprintf(cmd.Stdout, "%s: digest: %s size: 528\n", tag, digest)
+					return err
+				},
+			},
+		)
+
+		b = build{
+			name:       "upfluence/foo",
+			dockerfile: "Dockerfile",
+			context:    ".",
+			commit:     "0123456",
+			platforms:  []oci.Platform{{OS: "linux", Architecture: "amd64"}},
+			registries: []string{"index.docker.io", "ghcr.io"},
+			tags:       []string{"v1.0.0", "latest"},
+		}
+
+		bd = testBuilder(t, exc)
+	)
+
+	imgs, err := bd.build(context.Background(), b)
+	require.NoError(t, err)
+
+	assert.Len(t, exc.Commands(), 9)
+	assert.Equal(
+		t,
+		[]image{
+			{
+				Name:       "upfluence/foo",
+				Registry:   "index.docker.io",
+				Tags:       []string{"v1.0.0", "latest"},
+				Digest:     digest,
+				Platform:   "linux/amd64",
+				Platforms:  map[string]oci.Digest{"linux/amd64": digest},
+				Dockerfile: "Dockerfile",
+			},
+			{
+				Name:       "upfluence/foo",
+				Registry:   "ghcr.io",
+				Tags:       []string{"v1.0.0", "latest"},
+				Digest:     digest,
+				Platform:   "linux/amd64",
+				Platforms:  map[string]oci.Digest{"linux/amd64": digest},
+				Dockerfile: "Dockerfile",
+			},
+		},
+		imgs,
+	)
+	assert.Equal(t, "ghcr.io/upfluence/foo@"+digest.String(), imgs[1].reference())
+
+	bd.skipPush = true
+
+	imgs, err = bd.build(context.Background(), b)
+	require.NoError(t, err)
+	assert.Empty(t, imgs)
+
+	bd = testBuilder(t, fakeDocker(nil))
+
+	_, err = bd.build(context.Background(), b)
+	assert.ErrorContains(t, err, "printed no digest")
+}
+
+func TestBuilderIndex(t *testing.T) {
+	fr := fakeRegistry{manifests: make(map[string][]byte), types: make(map[string]string)}
+	srv := httptest.NewServer(&fr)
+
+	defer srv.Close()
+
+	var (
+		registry = strings.TrimPrefix(srv.URL, "http://")
+
+		platforms = []oci.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm64"},
+		}
+
+		exc = fakeDocker(nil)
+
+		b = build{
+			name:       "upfluence/foo",
+			dockerfile: "Dockerfile",
+			context:    ".",
+			commit:     "0123456",
+			platforms:  platforms,
+			registries: []string{registry},
+			tags:       []string{"v1.0.0", "latest"},
+			labels:     map[string]string{oci.AnnotationRevision: "0123456789"},
+		}
+
+		bd = testBuilder(t, exc)
+	)
+
+	bd.client = &oci.Client{PlainHTTP: true}
+	bd.mode = index
+
+	// what docker push would have left in the registry
+	fr.put("0123456-linux-amd64", oci.MediaTypeImageManifest, []byte(`{"schemaVersion":2,"layers":[]}`))
+
+	attested, err := json.Marshal(
+		oci.Index{
+			SchemaVersion: 2,
+			MediaType:     oci.MediaTypeImageIndex,
+			Manifests: []oci.Descriptor{
+				{MediaType: oci.MediaTypeImageManifest, Digest: "sha256:arm64", Platform: &platforms[1]},
+				{MediaType: oci.MediaTypeImageManifest, Digest: "sha256:att", Platform: &oci.Platform{OS: "unknown", Architecture: "unknown"}},
+			},
+		},
+	)
+	require.NoError(t, err)
+	fr.put("0123456-linux-arm64", oci.MediaTypeImageIndex, attested)
+
+	imgs, err := bd.build(context.Background(), b)
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[][]string{
+			{"build", "--file", "Dockerfile", "--tag", "upfluence/foo:0123456-linux-amd64", "--platform", "linux/amd64", "--label", oci.AnnotationRevision + "=0123456789", "."},
+			{"tag", "upfluence/foo:0123456-linux-amd64", registry + "/upfluence/foo:0123456-linux-amd64"},
+			{"push", registry + "/upfluence/foo:0123456-linux-amd64"},
+			{"build", "--file", "Dockerfile", "--tag", "upfluence/foo:0123456-linux-arm64", "--platform", "linux/arm64", "--label", oci.AnnotationRevision + "=0123456789", "."},
+			{"tag", "upfluence/foo:0123456-linux-arm64", registry + "/upfluence/foo:0123456-linux-arm64"},
+			{"push", registry + "/upfluence/foo:0123456-linux-arm64"},
+		},
+		argsOf(exc),
+	)
+
+	assert.Equal(t, fr.manifests["v1.0.0"], fr.manifests["latest"])
+
+	var idx oci.Index
+
+	require.NoError(t, json.Unmarshal(fr.manifests["latest"], &idx))
+	require.Len(t, idx.Manifests, 2)
+	assert.Equal(t, map[string]string{oci.AnnotationRevision: "0123456789"}, idx.Annotations)
+
+	assert.Equal(t, oci.DigestOf(fr.manifests["0123456-linux-amd64"]), idx.Manifests[0].Digest)
+	assert.Equal(t, &platforms[0], idx.Manifests[0].Platform)
+	assert.Equal(t, oci.Digest("sha256:arm64"), idx.Manifests[1].Digest)
+
+	assert.Equal(
+		t,
+		[]image{
+			{
+				Name:     "upfluence/foo",
+				Registry: registry,
+				Tags:     []string{"v1.0.0", "latest"},
+				Digest:   oci.DigestOf(fr.manifests["latest"]),
+				Platform: "linux/amd64,linux/arm64",
+				Platforms: map[string]oci.Digest{
+					"linux/amd64": idx.Manifests[0].Digest,
+					"linux/arm64": "sha256:arm64",
+				},
+				Dockerfile: "Dockerfile",
+			},
+		},
+		imgs,
+	)
+}
+
+func TestBuilderBuildx(t *testing.T) {
+	fr := fakeRegistry{manifests: make(map[string][]byte), types: make(map[string]string)}
+	srv := httptest.NewServer(&fr)
+
+	defer srv.Close()
+
+	idx, err := json.Marshal(
+		oci.Index{
+			SchemaVersion: 2,
+			MediaType:     oci.MediaTypeImageIndex,
+			Manifests: []oci.Descriptor{
+				{Digest: "sha256:amd64", Platform: &oci.Platform{OS: "linux", Architecture: "amd64"}},
+				{Digest: "sha256:arm64", Platform: &oci.Platform{OS: "linux", Architecture: "arm64"}},
+				{Digest: "sha256:att", Platform: &oci.Platform{OS: "unknown", Architecture: "unknown"}},
+			},
+		},
+	)
+	require.NoError(t, err)
+	fr.put("v1.0.0", oci.MediaTypeImageIndex, idx)
+
+	var (
+		registry = strings.TrimPrefix(srv.URL, "http://")
+
+		exc = fakeDocker(
+			dockerHandlers{
+				"buildx": func(cmd executil.Command) error {
+					i := slices.Index(cmd.Args, "--metadata-file")
+
+					return os.WriteFile(
+						cmd.Args[i+1],
+						[]byte(fmt.Sprintf(`{"containerimage.digest":%q}`, oci.DigestOf(idx))),
+						0644,
+					)
+				},
+			},
+		)
+
+		b = build{
+			name:       "upfluence/foo",
+			dockerfile: "Dockerfile",
+			context:    ".",
+			platforms: []oci.Platform{
+				{OS: "linux", Architecture: "amd64"},
+				{OS: "linux", Architecture: "arm64"},
+			},
+			registries: []string{registry},
+			tags:       []string{"v1.0.0"},
+		}
+
+		bd = testBuilder(t, exc)
+	)
+
+	bd.client = &oci.Client{PlainHTTP: true}
+
+	imgs, err := bd.build(context.Background(), b)
+	require.NoError(t, err)
+
+	require.Len(t, imgs, 1)
+	assert.Equal(t, oci.DigestOf(idx), imgs[0].Digest)
+	assert.Equal(
+		t,
+		map[string]oci.Digest{"linux/amd64": "sha256:amd64", "linux/arm64": "sha256:arm64"},
+		imgs[0].Platforms,
+	)
+}
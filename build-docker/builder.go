@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/upfluence/errors"
+	"github.com/upfluence/log"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/oci"
+)
+
+var pushDigestRegexp = regexp.MustCompile(`digest: (sha256:[a-f0-9]{64})`)
+
+type multiPlatformMode int
+
+const (
+	buildx multiPlatformMode = iota
+	index
+)
+
+func (m *multiPlatformMode) Parse(v string) error {
+	switch v {
+	case "buildx":
+		*m = buildx
+	case "index":
+		*m = index
+	default:
+		return fmt.Errorf("Invalid multi-platform-mode %q", v)
+	}
+
+	return nil
+}
+
+// image is a pushed image, as reported in the images output.
+type image struct {
+	Name       string                `json:"name"`
+	Registry   string                `json:"registry"`
+	Tags       []string              `json:"tags"`
+	Digest     oci.Digest            `json:"digest"`
+	Platform   string                `json:"platform"`
+	Platforms  map[string]oci.Digest `json:"platforms,omitempty"`
+	Dockerfile string                `json:"dockerfile"`
+}
+
+// reference pins the image to its digest, i.e. ghcr.io/upfluence/foo@sha256:...
+func (i image) reference() string {
+	return fmt.Sprintf("%s/%s@%s", i.Registry, i.Name, i.Digest)
+}
+
+type builder struct {
+	executor executil.Executor
+	client   *oci.Client
+	mode     multiPlatformMode
+	skipPush bool
+
+	// env is set on every docker command, i.e. the DOCKER_CONFIG of a
+	// login session.
+	env map[string]string
+
+	logger log.Logger
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (bd *builder) docker(ctx context.Context, args []string) error {
+	_, err := bd.dockerOutput(ctx, args)
+	return err
+}
+
+// dockerOutput runs docker and returns its stdout, which is still forwarded
+// to the one of the builder.
+func (bd *builder) dockerOutput(ctx context.Context, args []string) (string, error) {
+	var (
+		buf bytes.Buffer
+
+		stdout io.Writer = &buf
+	)
+
+	if bd.stdout != nil {
+		stdout = io.MultiWriter(bd.stdout, &buf)
+	}
+
+	err := bd.executor.Exec(
+		ctx,
+		executil.Command{
+			Cmd:    "docker",
+			Args:   args,
+			Env:    bd.env,
+			Stdout: stdout,
+			Stderr: bd.stderr,
+		},
+	)
+
+	return buf.String(), errors.Wrap(err, "cant exec docker command")
+}
+
+func (bd *builder) dockerAll(ctx context.Context, as [][]string) error {
+	for _, args := range as {
+		if err := bd.docker(ctx, args); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// build builds b and pushes it, it returns an image per registry b was
+// pushed to.
+func (bd *builder) build(ctx context.Context, b build) ([]image, error) {
+	var (
+		digests map[string]oci.Digest
+		err     error
+	)
+
+	switch {
+	case !b.multiPlatform():
+		digests, err = bd.buildSingle(ctx, b)
+	case bd.mode == index:
+		digests, err = bd.buildIndex(ctx, b)
+	default:
+		digests, err = bd.buildx(ctx, b)
+	}
+
+	if err != nil || bd.skipPush || len(b.tags) == 0 {
+		return nil, err
+	}
+
+	imgs := make([]image, 0, len(b.registries))
+
+	for _, r := range b.registries {
+		img := image{
+			Name:       b.name,
+			Registry:   r,
+			Tags:       b.tags,
+			Digest:     digests[r],
+			Platform:   b.platform(),
+			Dockerfile: b.dockerfile,
+		}
+
+		if !b.multiPlatform() {
+			img.Platforms = map[string]oci.Digest{img.Platform: img.Digest}
+		} else if img.Platforms, err = bd.platformDigests(ctx, b, r); err != nil {
+			// the images are pushed already, only the outputs are missing
+			bd.logger.Warningf("Cant read back the platforms of %s/%s: %v", r, b.name, err)
+		}
+
+		imgs = append(imgs, img)
+	}
+
+	return imgs, nil
+}
+
+// buildSingle builds the image with the docker daemon, the digests are
+// captured from the output of docker push.
+func (bd *builder) buildSingle(ctx context.Context, b build) (map[string]oci.Digest, error) {
+	if err := bd.docker(ctx, b.buildArgs()); err != nil {
+		return nil, err
+	}
+
+	if err := bd.dockerAll(ctx, b.tagArgs()); err != nil {
+		return nil, err
+	}
+
+	if bd.skipPush {
+		return nil, nil
+	}
+
+	digests := make(map[string]oci.Digest, len(b.registries))
+
+	for _, r := range b.registries {
+		for _, t := range b.tags {
+			ref := fmt.Sprintf("%s/%s:%s", r, b.name, t)
+			out, err := bd.dockerOutput(ctx, []string{"push", ref})
+
+			if err != nil {
+				return nil, err
+			}
+
+			m := pushDigestRegexp.FindStringSubmatch(out)
+
+			if m == nil {
+				return nil, fmt.Errorf("docker push of %s printed no digest", ref)
+			}
+
+			if d, ok := digests[r]; ok && d != oci.Digest(m[1]) {
+				return nil, fmt.Errorf("%s was pushed as %s, %s expected", ref, m[1], d)
+			}
+
+			digests[r] = oci.Digest(m[1])
+		}
+	}
+
+	return digests, nil
+}
+
+func (b build) platform() string {
+	ps := make([]string, len(b.platforms))
+
+	for i, p := range b.platforms {
+		ps[i] = p.String()
+	}
+
+	return strings.Join(ps, ",")
+}
+
+func (b build) buildxArgs(push bool, metadataFile string) []string {
+	vs := []string{
+		"buildx",
+		"build",
+		"--file",
+		b.dockerfile,
+		"--platform",
+		b.platform(),
+	}
+
+	refs := b.references(b.tags)
+
+	for _, ref := range refs {
+		vs = append(vs, "--tag", ref)
+	}
+
+	vs = append(vs, b.buildFlags("")...)
+	vs = append(vs, b.annotationFlags()...)
+
+	if push && len(refs) > 0 {
+		vs = append(vs, "--push")
+	}
+
+	if metadataFile != "" {
+		vs = append(vs, "--metadata-file", metadataFile)
+	}
+
+	return append(vs, b.context)
+}
+
+// buildx builds every platform at once and pushes the manifest list, it
+// requires a builder able to output multi-platform images such as the
+// docker-container driver. The digest is read from the buildx metadata.
+func (bd *builder) buildx(ctx context.Context, b build) (map[string]oci.Digest, error) {
+	if bd.skipPush {
+		bd.logger.Warningf(
+			"%s is only built in the buildx cache: multi-platform images can't be loaded in the docker daemon",
+			b.name,
+		)
+
+		return nil, bd.docker(ctx, b.buildxArgs(false, ""))
+	}
+
+	dir, err := os.MkdirTemp("", "build-docker")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "metadata.json")
+
+	if err := bd.docker(ctx, b.buildxArgs(true, fname)); err != nil {
+		return nil, err
+	}
+
+	if len(b.tags) == 0 {
+		return nil, nil
+	}
+
+	buf, err := os.ReadFile(fname)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cant read the buildx metadata")
+	}
+
+	var md struct {
+		Digest oci.Digest `json:"containerimage.digest"`
+	}
+
+	if err := json.Unmarshal(buf, &md); err != nil {
+		return nil, errors.Wrap(err, "invalid buildx metadata")
+	}
+
+	if err := md.Digest.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid buildx metadata")
+	}
+
+	digests := make(map[string]oci.Digest, len(b.registries))
+
+	for _, r := range b.registries {
+		digests[r] = md.Digest
+	}
+
+	return digests, nil
+}
+
+// platformTag is the tag the image of a single platform is pushed under
+// before being referenced by the index.
+func (b build) platformTag(p oci.Platform) string {
+	return b.commit + "-" + strings.ReplaceAll(p.String(), "/", "-")
+}
+
+// buildIndex builds and pushes every platform on its own, then assembles
+// and pushes an OCI index of them under every tag.
+func (bd *builder) buildIndex(ctx context.Context, b build) (map[string]oci.Digest, error) {
+	for _, p := range b.platforms {
+		local := fmt.Sprintf("%s:%s", b.name, b.platformTag(p))
+		tags := []string{b.platformTag(p)}
+
+		if err := bd.docker(ctx, b.platformBuildArgs(p, local)); err != nil {
+			return nil, err
+		}
+
+		if bd.skipPush {
+			continue
+		}
+
+		if err := bd.dockerAll(ctx, b.retagArgs(local, tags)); err != nil {
+			return nil, err
+		}
+
+		if err := bd.dockerAll(ctx, b.repushArgs(tags)); err != nil {
+			return nil, err
+		}
+	}
+
+	if bd.skipPush || len(b.tags) == 0 {
+		return nil, nil
+	}
+
+	digests := make(map[string]oci.Digest, len(b.registries))
+
+	for _, r := range b.registries {
+		ref, err := oci.ParseReference(r + "/" + b.name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ds := make([]oci.Descriptor, len(b.platforms))
+
+		for i, p := range b.platforms {
+			if ds[i], err = bd.platformManifest(ctx, ref.WithTag(b.platformTag(p)), p); err != nil {
+				return nil, err
+			}
+		}
+
+		d, err := bd.client.Push(ctx, ref.WithTag(b.tags[0]), oci.RemoteIndex{Manifests: ds, Annotations: b.labels}, b.tags[1:]...)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "cant push the index of %s", ref)
+		}
+
+		bd.logger.Noticef("Pushed the index of %s: %s", ref, d.Digest)
+		digests[r] = d.Digest
+	}
+
+	return digests, nil
+}
+
+// platformManifest resolves the manifest of p pushed at ref, docker may
+// push an index holding the manifest along with its attestations.
+func (bd *builder) platformManifest(ctx context.Context, ref oci.Reference, p oci.Platform) (oci.Descriptor, error) {
+	d, buf, err := bd.client.Resolve(ctx, ref)
+
+	if err != nil {
+		return d, err
+	}
+
+	if !oci.IsIndex(d.MediaType) {
+		d.Platform = &p
+		return d, nil
+	}
+
+	var idx oci.Index
+
+	if err := json.Unmarshal(buf, &idx); err != nil {
+		return d, errors.Wrapf(err, "cant decode the index of %s", ref)
+	}
+
+	for _, md := range idx.Manifests {
+		if md.Platform != nil && md.Platform.Match(p) {
+			return md, nil
+		}
+	}
+
+	return d, fmt.Errorf("%s holds no manifest for %s", ref, p)
+}
+
+// platformDigests reads back the manifest list pushed under the first tag
+// of b in registry and returns the digest of each of its platforms.
+func (bd *builder) platformDigests(ctx context.Context, b build, registry string) (map[string]oci.Digest, error) {
+	ref, err := oci.ParseReference(fmt.Sprintf("%s/%s:%s", registry, b.name, b.tags[0]))
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, idx, err := bd.client.Index(ctx, ref)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ds := make(map[string]oci.Digest, len(idx.Manifests))
+
+	for _, md := range idx.Manifests {
+		// buildx attaches its attestations as unknown/unknown manifests
+		if md.Platform == nil || md.Platform.OS == "unknown" {
+			continue
+		}
+
+		ds[md.Platform.String()] = md.Digest
+	}
+
+	return ds, nil
+}
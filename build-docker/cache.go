@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+type cacheType int
+
+const (
+	noCache cacheType = iota
+	registryCache
+	localCache
+	inlineCache
+	ghaCache
+)
+
+func (ct *cacheType) Parse(v string) error {
+	switch v {
+	case "none", "":
+		*ct = noCache
+	case "registry":
+		*ct = registryCache
+	case "local":
+		*ct = localCache
+	case "inline":
+		*ct = inlineCache
+	case "gha":
+		*ct = ghaCache
+	default:
+		return fmt.Errorf("Invalid cache-type %q", v)
+	}
+
+	return nil
+}
+
+// defaultRef is the location of the cache of each type, the image ref of
+// registry and inline caches, the directory of local caches or the scope
+// of gha caches. Inline caches live in the pushed images, their default is
+// the branch tag of the app tag mode.
+func (ct cacheType) defaultRef() string {
+	switch ct {
+	case registryCache:
+		return "{{ .Registry }}/{{ .Name }}:cache-{{ .Branch }}{{ with .Platform }}-{{ . }}{{ end }}"
+	case inlineCache:
+		return "{{ .Registry }}/{{ .Name }}:" + branchTag
+	case localCache:
+		return ".buildx-cache/{{ .Name }}/{{ .Branch }}{{ with .Platform }}/{{ . }}{{ end }}"
+	case ghaCache:
+		return "{{ .Name }}-{{ .Branch }}{{ with .Platform }}-{{ . }}{{ end }}"
+	}
+
+	return ""
+}
+
+type cacheMode int
+
+const (
+	minCacheMode cacheMode = iota
+	maxCacheMode
+)
+
+func (cm *cacheMode) Parse(v string) error {
+	switch v {
+	case "min":
+		*cm = minCacheMode
+	case "max":
+		*cm = maxCacheMode
+	default:
+		return fmt.Errorf("Invalid cache-mode %q", v)
+	}
+
+	return nil
+}
+
+func (cm cacheMode) String() string {
+	if cm == maxCacheMode {
+		return "max"
+	}
+
+	return "min"
+}
+
+type refTemplate struct {
+	t *template.Template
+}
+
+func (rt *refTemplate) Parse(v string) error {
+	if v == "" {
+		rt.t = nil
+		return nil
+	}
+
+	var err error
+
+	rt.t, err = template.New("").Option("missingkey=error").Parse(v)
+
+	return err
+}
+
+func (rt refTemplate) render(cc cacheContext) (string, error) {
+	var buf bytes.Buffer
+
+	if err := rt.t.Execute(&buf, cc); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// cacheContext is the data of the cache-ref template, Branch and Platform
+// are sanitized to fit in a tag. Platform is only set when each platform is
+// built on its own.
+type cacheContext struct {
+	Registry string
+	Name     string
+	Branch   string
+	Platform string
+}
+
+type cacheOptions struct {
+	typ  cacheType
+	ref  refTemplate
+	mode cacheMode
+
+	branch        string
+	defaultBranch string
+}
+
+func (c *config) cacheOptions(cctx toolkit.CommandContext) (cacheOptions, error) {
+	co := cacheOptions{
+		typ:           c.CacheType,
+		ref:           c.CacheRef,
+		mode:          c.CacheMode,
+		branch:        branch(cctx),
+		defaultBranch: c.DefaultBranch,
+	}
+
+	if co.typ == noCache {
+		return co, nil
+	}
+
+	if co.ref.t == nil {
+		if co.typ == inlineCache && c.TagMode != app {
+			return co, errors.New("cache-ref is required by inline caches unless tag-mode is app")
+		}
+
+		if err := co.ref.Parse(co.typ.defaultRef()); err != nil {
+			return co, err
+		}
+	}
+
+	if _, err := co.ref.render(cacheContext{}); err != nil {
+		return co, errors.Wrap(err, "invalid cache-ref")
+	}
+
+	return co, nil
+}
+
+// flags returns the --cache-from and --cache-to flags of b, the cache of
+// the branch is imported along with the one of the default branch for the
+// first build of a branch.
+func (co cacheOptions) flags(b build, platform string) ([]string, error) {
+	if co.typ == noCache {
+		return nil, nil
+	}
+
+	cc := cacheContext{
+		Registry: b.registries[0],
+		Name:     b.name,
+		Branch:   sanitizeTag(co.branch),
+		Platform: sanitizeTag(strings.ReplaceAll(platform, "/", "-")),
+	}
+
+	ref, err := co.ref.render(cc)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cant render the cache-ref")
+	}
+
+	refs := []string{ref}
+
+	if co.defaultBranch != "" && co.defaultBranch != co.branch {
+		cc.Branch = sanitizeTag(co.defaultBranch)
+
+		ref, err := co.ref.render(cc)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "cant render the cache-ref")
+		}
+
+		refs = append(refs, ref)
+	}
+
+	var vs []string
+
+	for _, ref := range refs {
+		vs = append(vs, "--cache-from", co.importSpec(ref))
+	}
+
+	return append(vs, "--cache-to", co.exportSpec(refs[0])), nil
+}
+
+func (co cacheOptions) importSpec(ref string) string {
+	switch co.typ {
+	case localCache:
+		return "type=local,src=" + ref
+	case ghaCache:
+		return "type=gha,scope=" + ref
+	}
+
+	return "type=registry,ref=" + ref
+}
+
+func (co cacheOptions) exportSpec(ref string) string {
+	switch co.typ {
+	case inlineCache:
+		return "type=inline"
+	case localCache:
+		return fmt.Sprintf("type=local,dest=%s,mode=%s", ref, co.mode)
+	case ghaCache:
+		return fmt.Sprintf("type=gha,scope=%s,mode=%s", ref, co.mode)
+	}
+
+	return fmt.Sprintf("type=registry,ref=%s,mode=%s", ref, co.mode)
+}
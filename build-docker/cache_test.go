@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+func TestCacheFlags(t *testing.T) {
+	b := build{name: "upfluence/foo", registries: []string{"ghcr.io", "index.docker.io"}}
+
+	for _, tt := range []struct {
+		name     string
+		c        config
+		ref      string
+		cctx     toolkit.CommandContext
+		platform string
+
+		want    []string
+		wantErr bool
+	}{
+		{name: "none", cctx: toolkit.CommandContext{RefName: "main"}},
+		{
+			name: "registry on the default branch",
+			c:    config{CacheType: registryCache, CacheMode: maxCacheMode, DefaultBranch: "main"},
+			cctx: toolkit.CommandContext{RefName: "main"},
+			want: []string{
+				"--cache-from", "type=registry,ref=ghcr.io/upfluence/foo:cache-main",
+				"--cache-to", "type=registry,ref=ghcr.io/upfluence/foo:cache-main,mode=max",
+			},
+		},
+		{
+			name: "registry on a pull request",
+			c:    config{CacheType: registryCache, DefaultBranch: "main"},
+			cctx: toolkit.CommandContext{RefName: "12/merge", HeadRef: "feature/foo"},
+			want: []string{
+				"--cache-from", "type=registry,ref=ghcr.io/upfluence/foo:cache-feature-foo",
+				"--cache-from", "type=registry,ref=ghcr.io/upfluence/foo:cache-main",
+				"--cache-to", "type=registry,ref=ghcr.io/upfluence/foo:cache-feature-foo,mode=min",
+			},
+		},
+		{
+			name:     "gha per platform",
+			c:        config{CacheType: ghaCache, CacheMode: maxCacheMode},
+			cctx:     toolkit.CommandContext{RefName: "feature"},
+			platform: "linux/arm/v7",
+			want: []string{
+				"--cache-from", "type=gha,scope=upfluence/foo-feature-linux-arm-v7",
+				"--cache-to", "type=gha,scope=upfluence/foo-feature-linux-arm-v7,mode=max",
+			},
+		},
+		{
+			name:     "inline",
+			c:        config{CacheType: inlineCache, TagMode: app, DefaultBranch: "master"},
+			cctx:     toolkit.CommandContext{RefName: "feature"},
+			platform: "linux/arm64",
+			want: []string{
+				"--cache-from", "type=registry,ref=ghcr.io/upfluence/foo:feature",
+				"--cache-from", "type=registry,ref=ghcr.io/upfluence/foo:latest",
+				"--cache-to", "type=inline",
+			},
+		},
+		{
+			name:    "inline without the app tags",
+			c:       config{CacheType: inlineCache, TagMode: none},
+			cctx:    toolkit.CommandContext{RefName: "main"},
+			wantErr: true,
+		},
+		{
+			name: "inline with a custom ref",
+			c:    config{CacheType: inlineCache, TagMode: none},
+			ref:  "{{ .Registry }}/{{ .Name }}:edge",
+			cctx: toolkit.CommandContext{RefName: "main"},
+			want: []string{
+				"--cache-from", "type=registry,ref=ghcr.io/upfluence/foo:edge",
+				"--cache-to", "type=inline",
+			},
+		},
+		{
+			name: "local with a custom ref",
+			c:    config{CacheType: localCache},
+			ref:  "/tmp/cache/{{ .Branch }}",
+			cctx: toolkit.CommandContext{RefName: "main"},
+			want: []string{
+				"--cache-from", "type=local,src=/tmp/cache/main",
+				"--cache-to", "type=local,dest=/tmp/cache/main,mode=min",
+			},
+		},
+		{
+			name:    "invalid ref",
+			c:       config{CacheType: registryCache},
+			ref:     "{{ .Tag }}",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.c.CacheRef.Parse(tt.ref))
+
+			co, err := tt.c.cacheOptions(tt.cctx)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			vs, err := co.flags(b, tt.platform)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, vs)
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/oci"
+)
+
+// instructions returns the instructions of a Dockerfile, continuation
+// lines joined and comments dropped.
+func instructions(fname string) ([]string, error) {
+	f, err := os.Open(fname)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var (
+		is  []string
+		cur strings.Builder
+
+		sc = bufio.NewScanner(f)
+	)
+
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+
+		if strings.HasPrefix(l, "#") || (l == "" && cur.Len() == 0) {
+			continue
+		}
+
+		if v, ok := strings.CutSuffix(l, `\`); ok {
+			cur.WriteString(v + " ")
+			continue
+		}
+
+		cur.WriteString(l)
+		is = append(is, cur.String())
+		cur.Reset()
+	}
+
+	if cur.Len() > 0 {
+		is = append(is, cur.String())
+	}
+
+	return is, sc.Err()
+}
+
+// expand substitutes $VAR, ${VAR} and ${VAR:-default} out of vars.
+func expand(v string, vars map[string]string) string {
+	return os.Expand(v, func(k string) string {
+		k, def, hasDef := strings.Cut(k, ":-")
+
+		if v, ok := vars[k]; ok && (v != "" || !hasDef) {
+			return v
+		}
+
+		return def
+	})
+}
+
+// dockerfileImages returns the images the Dockerfile at fname is built
+// FROM or copies files from, its own stages excluded. The ARGs declared
+// before the first FROM are expanded with their defaults, overridden by
+// args.
+func dockerfileImages(fname string, args map[string]string) ([]string, error) {
+	is, err := instructions(fname)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		images []string
+		stages []string
+
+		vars = make(map[string]string)
+	)
+
+	add := func(v string) {
+		v = expand(v, vars)
+
+		if v == "" || v == "scratch" || slices.Contains(stages, strings.ToLower(v)) {
+			return
+		}
+
+		if _, err := strconv.Atoi(v); err == nil {
+			// COPY --from=<stage index>
+			return
+		}
+
+		if !slices.Contains(images, v) {
+			images = append(images, v)
+		}
+	}
+
+	for _, i := range is {
+		fs := strings.Fields(i)
+
+		switch strings.ToUpper(fs[0]) {
+		case "ARG":
+			if len(stages) > 0 || len(fs) < 2 {
+				continue
+			}
+
+			for _, a := range fs[1:] {
+				k, v, _ := strings.Cut(a, "=")
+
+				if av, ok := args[k]; ok {
+					v = av
+				}
+
+				vars[k] = strings.Trim(v, `"'`)
+			}
+		case "FROM":
+			var rest []string
+
+			for _, f := range fs[1:] {
+				if !strings.HasPrefix(f, "--") {
+					rest = append(rest, f)
+				}
+			}
+
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("%s: invalid instruction %q", fname, i)
+			}
+
+			add(rest[0])
+
+			if len(rest) == 3 && strings.EqualFold(rest[1], "AS") {
+				stages = append(stages, strings.ToLower(rest[2]))
+			}
+		case "COPY", "ADD":
+			for _, f := range fs[1:] {
+				if v, ok := strings.CutPrefix(f, "--from="); ok {
+					add(v)
+				}
+			}
+		}
+	}
+
+	return images, nil
+}
+
+// produces reports whether ref is one of the images pushed or tagged by b.
+func (b build) produces(ref oci.Reference) bool {
+	tag := ref.Tag
+
+	if tag == "" {
+		tag = "latest"
+	}
+
+	for _, v := range append(b.references(b.tags), b.intermediateTag()) {
+		r, err := oci.ParseReference(v)
+
+		if err == nil && r.Registry == ref.Registry && r.Repository == ref.Repository && r.Tag == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveDependencies sets the builds every build depends on, the ones
+// producing an image its Dockerfile uses, and fails on cycles.
+func resolveDependencies(bs []build) error {
+	for i := range bs {
+		images, err := dockerfileImages(bs[i].dockerfile, bs[i].args)
+
+		if err != nil {
+			return errors.Wrapf(err, "cant parse %s", bs[i].dockerfile)
+		}
+
+		bs[i].deps = nil
+
+		for _, img := range images {
+			ref, err := oci.ParseReference(img)
+
+			if err != nil {
+				// pinned by digest, or not an image of this run
+				continue
+			}
+
+			for j := range bs {
+				if j != i && bs[j].produces(ref) && !slices.Contains(bs[i].deps, j) {
+					bs[i].deps = append(bs[i].deps, j)
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		state = make([]int, len(bs))
+		path  []int
+
+		visit func(int) error
+	)
+
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			var names []string
+
+			for _, j := range path[slices.Index(path, i):] {
+				names = append(names, bs[j].dockerfile)
+			}
+
+			return fmt.Errorf(
+				"dependency cycle between the dockerfiles: %s -> %s",
+				strings.Join(names, " -> "),
+				bs[i].dockerfile,
+			)
+		}
+
+		state[i] = visiting
+		path = append(path, i)
+
+		for _, j := range bs[i].deps {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[i] = visited
+
+		return nil
+	}
+
+	for i := range bs {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildAll runs the builds once their dependencies are built, at most
+// parallelism at once. The images are returned in the order of bs.
+func (bd *builder) buildAll(parent context.Context, bs []build, parallelism int) ([]image, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		wg sync.WaitGroup
+
+		mu       sync.Mutex
+		firstErr error
+
+		done = make([]chan struct{}, len(bs))
+		res  = make([][]image, len(bs))
+		ok   = make([]bool, len(bs))
+		sem  = make(chan struct{}, max(parallelism, 1))
+	)
+
+	for i := range bs {
+		done[i] = make(chan struct{})
+	}
+
+	for i, b := range bs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, d := range b.deps {
+				<-done[d]
+
+				if !ok[d] {
+					return
+				}
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			imgs, err := bd.build(ctx, b)
+
+			if err != nil {
+				mu.Lock()
+
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, "cant build %s", b.dockerfile)
+				}
+
+				mu.Unlock()
+				cancel()
+
+				return
+			}
+
+			res[i], ok[i] = imgs, true
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+
+	imgs := make([]image, 0, len(bs))
+
+	for _, is := range res {
+		imgs = append(imgs, is...)
+	}
+
+	return imgs, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/oci"
+)
+
+func writeDockerfile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	fname := filepath.Join(dir, name, "Dockerfile")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(fname), 0755))
+	require.NoError(t, os.WriteFile(fname, []byte(content), 0644))
+
+	return fname
+}
+
+func TestDockerfileImages(t *testing.T) {
+	fname := writeDockerfile(
+		t,
+		t.TempDir(),
+		"app",
+		`# syntax=docker/dockerfile:1
+ARG BASE=upfluence/base
+ARG GO_VERSION
+
+FROM ${BASE}:${TAG:-latest} AS builder
+FROM --platform=$BUILDPLATFORM \
+  golang:${GO_VERSION} AS Tools
+
+COPY --from=builder /bin/foo /bin/foo
+COPY --from=0 /bin/bar /bin/bar
+COPY --from=tools /go/bin /go/bin
+copy --from=ghcr.io/upfluence/assets:v1 /assets /assets
+
+FROM scratch
+`,
+	)
+
+	images, err := dockerfileImages(fname, map[string]string{"GO_VERSION": "1.22"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"upfluence/base:latest", "golang:1.22", "ghcr.io/upfluence/assets:v1"}, images)
+
+	images, err = dockerfileImages(fname, map[string]string{"BASE": "ghcr.io/upfluence/base", "TAG": "v2"})
+	require.NoError(t, err)
+	// TAG is not declared, as docker does the build arg is ignored
+	assert.Equal(t, []string{"ghcr.io/upfluence/base:latest", "golang:", "ghcr.io/upfluence/assets:v1"}, images)
+}
+
+func testBuilds(t *testing.T, dockerfiles map[string]string) []build {
+	dir := t.TempDir()
+
+	var bs []build
+
+	for _, name := range []string{"base", "app", "worker"} {
+		content, ok := dockerfiles[name]
+
+		if !ok {
+			continue
+		}
+
+		bs = append(
+			bs,
+			build{
+				name:       "upfluence/" + name,
+				dockerfile: writeDockerfile(t, dir, name, content),
+				commit:     "0123456",
+				platforms:  []oci.Platform{{OS: "linux", Architecture: "amd64"}},
+				registries: []string{"index.docker.io", "ghcr.io"},
+				tags:       []string{"v1.0.0", "latest"},
+			},
+		)
+	}
+
+	return bs
+}
+
+func TestResolveDependencies(t *testing.T) {
+	bs := testBuilds(
+		t,
+		map[string]string{
+			"base":   "FROM alpine:3.20\n",
+			"app":    "FROM upfluence/base:v1.0.0\nCOPY --from=ghcr.io/upfluence/worker /bin /bin\n",
+			"worker": "FROM upfluence/base:v0.9.0\nFROM upfluence/base@sha256:abc\nFROM upfluence/worker:latest\n",
+		},
+	)
+
+	require.NoError(t, resolveDependencies(bs))
+
+	assert.Empty(t, bs[0].deps)
+	assert.Equal(t, []int{0, 2}, bs[1].deps)
+	assert.Empty(t, bs[2].deps)
+
+	bs = testBuilds(
+		t,
+		map[string]string{
+			"base":   "FROM upfluence/worker\n",
+			"app":    "FROM upfluence/base:0123456\n",
+			"worker": "FROM ghcr.io/upfluence/app:latest\n",
+		},
+	)
+
+	assert.ErrorContains(t, resolveDependencies(bs), "dependency cycle between the dockerfiles")
+}
+
+func TestBuilderBuildAll(t *testing.T) {
+	bs := testBuilds(
+		t,
+		map[string]string{
+			"base":   "FROM alpine:3.20\n",
+			"app":    "FROM upfluence/base:latest\n",
+			"worker": "FROM alpine:3.20\n",
+		},
+	)
+
+	require.NoError(t, resolveDependencies(bs))
+
+	var (
+		mu    sync.Mutex
+		built []string
+		fail  string
+
+		bd = testBuilder(
+			t,
+			fakeDocker(
+				dockerHandlers{
+					"build": func(cmd executil.Command) error {
+						mu.Lock()
+						defer mu.Unlock()
+
+						tag := cmd.Args[4]
+						built = append(built, tag)
+
+						if tag == fail {
+							return fmt.Errorf("exit status 1")
+						}
+
+						return nil
+					},
+				},
+			),
+		)
+	)
+
+	bd.skipPush = true
+
+	imgs, err := bd.buildAll(context.Background(), bs, 3)
+	require.NoError(t, err)
+	assert.Empty(t, imgs)
+	assert.Len(t, built, 3)
+	assert.Less(t, slices.Index(built, "upfluence/base:0123456"), slices.Index(built, "upfluence/app:0123456"))
+
+	built, fail = nil, "upfluence/base:0123456"
+
+	_, err = bd.buildAll(context.Background(), bs, 1)
+	assert.ErrorContains(t, err, "cant build "+bs[0].dockerfile)
+	assert.NotContains(t, built, "upfluence/app:0123456")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/google/go-github/v53/github"
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+func parseVersion(v string) (*semver.Version, error) {
+	return semver.NewVersion(strings.ReplaceAll(v, "_", "+"))
+}
+
+// isRelease excludes the rc prereleases and the pre metadata produced by
+// bump-version.
+func isRelease(v *semver.Version) bool {
+	return v.Prerelease() == "" && v.Metadata() == ""
+}
+
+// floatingTags returns the major, major.minor and major.minor.patch tags of
+// v. The major and major.minor ones are only returned when v is the highest
+// release of their line among tags, so that rebuilding an older patch does
+// not move them backwards.
+func floatingTags(v string, tags []string) ([]string, error) {
+	sv, err := parseVersion(v)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "floating tags require a semver version, got %q", v)
+	}
+
+	if !isRelease(sv) {
+		return nil, nil
+	}
+
+	highestMajor, highestMinor := true, true
+
+	for _, t := range tags {
+		tv, err := parseVersion(t)
+
+		if err != nil || !isRelease(tv) || tv.Major() != sv.Major() || !tv.GreaterThan(sv) {
+			continue
+		}
+
+		highestMajor = false
+
+		if tv.Minor() == sv.Minor() {
+			highestMinor = false
+		}
+	}
+
+	var vs []string
+
+	if highestMajor {
+		vs = append(vs, fmt.Sprint(sv.Major()))
+	}
+
+	if highestMinor {
+		vs = append(vs, fmt.Sprintf("%d.%d", sv.Major(), sv.Minor()))
+	}
+
+	return append(vs, fmt.Sprintf("%d.%d.%d", sv.Major(), sv.Minor(), sv.Patch())), nil
+}
+
+func fetchTags(ctx context.Context, cctx toolkit.CommandContext) ([]string, error) {
+	var (
+		vs []string
+
+		org, repo = cctx.SplittedRepository()
+		opts      = github.ListOptions{PerPage: 100}
+	)
+
+	for {
+		tags, resp, err := cctx.Client.Repositories.ListTags(ctx, org, repo, &opts)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "cant list the tags of the repository")
+		}
+
+		for _, t := range tags {
+			vs = append(vs, t.GetName())
+		}
+
+		if resp.NextPage == 0 {
+			return vs, nil
+		}
+
+		opts.Page = resp.NextPage
+	}
+}
+
+func (c *config) floatingTags(ctx context.Context, cctx toolkit.CommandContext) ([]string, error) {
+	if !c.FloatingTags {
+		return nil, nil
+	}
+
+	tags, err := fetchTags(ctx, cctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	vs, err := floatingTags(c.Version, tags)
+
+	if err == nil && len(vs) == 0 {
+		cctx.Logger.Noticef("Skipping the floating tags of the prerelease %s", c.Version)
+	}
+
+	return vs, err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/upfluence/log/logtest"
+
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+func TestFloatingTags(t *testing.T) {
+	tags := []string{"v1.3.0", "v1.4.1", "v1.4.3-rc1", "v1.5.0_pre1", "v2.0.0", "latest"}
+
+	for _, tt := range []struct {
+		v string
+
+		want    []string
+		wantErr bool
+	}{
+		{v: "v1.4.2", want: []string{"1", "1.4", "1.4.2"}},
+		{v: "v1.3.1", want: []string{"1.3", "1.3.1"}},
+		{v: "v1.3.0", want: []string{"1.3", "1.3.0"}},
+		{v: "v2.0.0", want: []string{"2", "2.0", "2.0.0"}},
+		{v: "v1.4.3-rc2"},
+		{v: "v1.4.3_pre1"},
+		{v: "nightly", wantErr: true},
+	} {
+		vs, err := floatingTags(tt.v, tags)
+
+		if tt.wantErr {
+			assert.Error(t, err, tt.v)
+			continue
+		}
+
+		require.NoError(t, err, tt.v)
+		assert.Equal(t, tt.want, vs, tt.v)
+	}
+}
+
+func TestConfigFloatingTags(t *testing.T) {
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/repos/upfluence/foo/tags" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			if r.URL.Query().Get("page") == "2" {
+				fmt.Fprint(w, `[{"name":"v1.5.0"}]`)
+				return
+			}
+
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/upfluence/foo/tags?page=2>; rel="next"`, srv.URL))
+			fmt.Fprint(w, `[{"name":"v1.4.1"},{"name":"v1.3.0"}]`)
+		}),
+	)
+
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	cctx := toolkit.CommandContext{
+		Logger:     logtest.WrapTestingLogger(t),
+		Client:     client,
+		Repository: "upfluence/foo",
+	}
+
+	c := config{Version: "v1.4.2", FloatingTags: true}
+
+	vs, err := c.floatingTags(context.Background(), cctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.4", "1.4.2"}, vs)
+
+	c.FloatingTags = false
+
+	vs, err = c.floatingTags(context.Background(), cctx)
+	require.NoError(t, err)
+	assert.Empty(t, vs)
+}
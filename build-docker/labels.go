@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/upfluence/actions/pkg/oci"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+// repositoryLabels describes the repository out of its GitHub metadata, a
+// failure only costs these labels.
+func repositoryLabels(ctx context.Context, cctx toolkit.CommandContext) map[string]string {
+	org, name := cctx.SplittedRepository()
+
+	repo, _, err := cctx.Client.Repositories.Get(ctx, org, name)
+
+	if err != nil {
+		cctx.Logger.Warningf("Cant fetch the metadata of %s: %v", cctx.Repository, err)
+		return nil
+	}
+
+	ls := map[string]string{oci.AnnotationURL: repo.GetHTMLURL()}
+
+	if h := repo.GetHomepage(); h != "" {
+		ls[oci.AnnotationURL] = h
+	}
+
+	if id := repo.GetLicense().GetSPDXID(); id != "" && id != "NOASSERTION" {
+		ls[oci.AnnotationLicenses] = id
+	}
+
+	return ls
+}
+
+// labels returns the org.opencontainers.image labels shared by every build,
+// the title is set per build.
+func (c *config) labels(ctx context.Context, cctx toolkit.CommandContext, now time.Time) map[string]string {
+	ls := map[string]string{
+		oci.AnnotationSource:   "https://github.com/" + cctx.Repository,
+		oci.AnnotationRevision: cctx.Sha,
+		oci.AnnotationCreated:  now.UTC().Format(time.RFC3339),
+	}
+
+	if c.Version != "" {
+		ls[oci.AnnotationVersion] = c.Version
+	}
+
+	maps.Copy(ls, repositoryLabels(ctx, cctx))
+
+	return ls
+}
+
+func (b build) labelFlags() []string {
+	var vs []string
+
+	for _, k := range slices.Sorted(maps.Keys(b.labels)) {
+		vs = append(vs, "--label", fmt.Sprintf("%s=%s", k, b.labels[k]))
+	}
+
+	return vs
+}
+
+// annotationFlags copies the labels as annotations of the manifest list and
+// of its manifests, labels only land in the config of each platform.
+func (b build) annotationFlags() []string {
+	var vs []string
+
+	for _, level := range []string{"index", "manifest"} {
+		for _, k := range slices.Sorted(maps.Keys(b.labels)) {
+			vs = append(vs, "--annotation", fmt.Sprintf("%s:%s=%s", level, k, b.labels[k]))
+		}
+	}
+
+	return vs
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/upfluence/log/logtest"
+
+	"github.com/upfluence/actions/pkg/oci"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+func TestConfigLabels(t *testing.T) {
+	srv := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/repos/upfluence/foo" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			fmt.Fprint(
+				w,
+				`{"html_url":"https://github.com/upfluence/foo","homepage":"","license":{"spdx_id":"MIT"}}`,
+			)
+		}),
+	)
+
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	var (
+		now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		cctx = toolkit.CommandContext{
+			Logger:     logtest.WrapTestingLogger(t),
+			Client:     client,
+			Repository: "upfluence/foo",
+			Sha:        "0123456789",
+		}
+
+		c = config{Version: "v1.0.0"}
+	)
+
+	assert.Equal(
+		t,
+		map[string]string{
+			oci.AnnotationSource:   "https://github.com/upfluence/foo",
+			oci.AnnotationRevision: "0123456789",
+			oci.AnnotationCreated:  "2024-01-02T03:04:05Z",
+			oci.AnnotationVersion:  "v1.0.0",
+			oci.AnnotationURL:      "https://github.com/upfluence/foo",
+			oci.AnnotationLicenses: "MIT",
+		},
+		c.labels(context.Background(), cctx, now),
+	)
+
+	cctx.Repository = "upfluence/bar"
+
+	assert.Equal(
+		t,
+		map[string]string{
+			oci.AnnotationSource:   "https://github.com/upfluence/bar",
+			oci.AnnotationRevision: "0123456789",
+			oci.AnnotationCreated:  "2024-01-02T03:04:05Z",
+			oci.AnnotationVersion:  "v1.0.0",
+		},
+		c.labels(context.Background(), cctx, now),
+	)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/ecr"
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/oci"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+// registryCredential is an entry of the registry credentials file, a token
+// is logged in with the owner of the repository as username.
+type registryCredential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+}
+
+type login struct {
+	registry string
+	cred     oci.Credential
+}
+
+func (c *config) credentialsFile() (map[string]registryCredential, error) {
+	if c.RegistryCredentialsFile == "" {
+		return nil, nil
+	}
+
+	buf, err := os.ReadFile(c.RegistryCredentialsFile)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cant read the registry credentials file")
+	}
+
+	var creds map[string]registryCredential
+
+	if err := json.Unmarshal(buf, &creds); err != nil {
+		return nil, errors.Wrapf(err, "invalid registry credentials file %q", c.RegistryCredentialsFile)
+	}
+
+	return creds, nil
+}
+
+// logins returns the credential of every registry build-docker has to log
+// in, out of the credentials file, the registry username and password, or
+// an ECR token exchange. Registries without credential rely on the login of
+// the runner.
+func (c *config) logins(ctx context.Context, cctx toolkit.CommandContext) ([]login, error) {
+	creds, err := c.credentialsFile()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ls []login
+
+		owner, _ = cctx.SplittedRepository()
+	)
+
+	for _, r := range c.Registries {
+		var (
+			cred oci.Credential
+			ok   bool
+		)
+
+		switch rc, inFile := creds[r]; {
+		case inFile:
+			cred, ok = oci.Credential{Username: rc.Username, Password: rc.Password}, true
+
+			if rc.Token != "" {
+				cred.Password = rc.Token
+			}
+		case c.RegistryPassword != "" &&
+			(len(c.LoginRegistries) == 0 || slices.Contains(c.LoginRegistries, r)):
+			cred, ok = oci.Credential{Username: c.RegistryUsername, Password: c.RegistryPassword}, true
+		default:
+			account, region, isECR := ecr.ParseRegistry(r)
+
+			if !isECR {
+				break
+			}
+
+			awsCreds, hasCreds := ecr.CredentialsFromEnv()
+
+			if !hasCreds {
+				cctx.Logger.Warningf("No AWS credentials in the environment to log in %s", r)
+				break
+			}
+
+			ec := ecr.Client{Credentials: awsCreds, Endpoint: c.ECREndpoint}
+
+			if cred, err = ec.Login(ctx, account, region); err != nil {
+				return nil, errors.Wrapf(err, "cant exchange the ECR token of %s", r)
+			}
+
+			ok = true
+		}
+
+		if !ok {
+			continue
+		}
+
+		if cred.Username == "" {
+			cred.Username = owner
+		}
+
+		if cred.Password == "" {
+			return nil, fmt.Errorf("no password nor token for %s", r)
+		}
+
+		ls = append(ls, login{registry: r, cred: cred})
+	}
+
+	return ls, nil
+}
+
+// loginSession is a docker config dir holding the logins of build-docker,
+// so that they never land in the config of the runner.
+type loginSession struct {
+	dir string
+}
+
+// seedDockerConfig makes dir a copy of the docker config of the runner, the
+// cli plugins and buildx builders are linked so that buildx keeps working.
+func seedDockerConfig(dir string, registries []string) error {
+	src, err := oci.DockerConfigDir()
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Name() != "config.json" {
+			if err := os.Symlink(filepath.Join(src, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		buf, err := os.ReadFile(filepath.Join(src, e.Name()))
+
+		if err != nil {
+			return err
+		}
+
+		if buf, err = dropCredentialStores(buf, registries); err != nil {
+			return errors.Wrapf(err, "invalid docker config %q", filepath.Join(src, e.Name()))
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, e.Name()), buf, 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dropCredentialStores removes the credential store and the credential
+// helpers of the registries from a docker config, otherwise docker login
+// would write the credentials of build-docker to the keychain of the runner
+// rather than to the seeded config.
+func dropCredentialStores(buf []byte, registries []string) ([]byte, error) {
+	var cfg map[string]json.RawMessage
+
+	if err := json.Unmarshal(buf, &cfg); err != nil {
+		return nil, err
+	}
+
+	delete(cfg, "credsStore")
+
+	if raw, ok := cfg["credHelpers"]; ok {
+		var helpers map[string]string
+
+		if err := json.Unmarshal(raw, &helpers); err != nil {
+			return nil, err
+		}
+
+		for _, r := range registries {
+			delete(helpers, r)
+		}
+
+		raw, err := json.Marshal(helpers)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cfg["credHelpers"] = raw
+	}
+
+	return json.MarshalIndent(cfg, "", "\t")
+}
+
+// login runs docker login for every login in a fresh docker config, every
+// later docker command of the builder uses it.
+func (bd *builder) login(ctx context.Context, ls []login) (*loginSession, error) {
+	if len(ls) == 0 {
+		return nil, nil
+	}
+
+	dir, err := os.MkdirTemp("", "build-docker-config")
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := loginSession{dir: dir}
+
+	registries := make([]string, len(ls))
+
+	for i, l := range ls {
+		registries[i] = l.registry
+	}
+
+	if err := seedDockerConfig(dir, registries); err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "cant seed the docker config")
+	}
+
+	bd.env = map[string]string{"DOCKER_CONFIG": dir}
+
+	for _, l := range ls {
+		if err := bd.executor.Exec(
+			ctx,
+			executil.Command{
+				Cmd:    "docker",
+				Args:   []string{"login", "--username", l.cred.Username, "--password-stdin", l.registry},
+				Env:    bd.env,
+				Stdin:  strings.NewReader(l.cred.Password),
+				Stdout: bd.stdout,
+				Stderr: bd.stderr,
+			},
+		); err != nil {
+			bd.logout(&s)
+			return nil, errors.Wrapf(err, "cant log in %s", l.registry)
+		}
+	}
+
+	return &s, nil
+}
+
+// logout removes the docker config of s, the logins are dropped with it.
+func (bd *builder) logout(s *loginSession) error {
+	if s == nil {
+		return nil
+	}
+
+	bd.env = nil
+
+	return os.RemoveAll(s.dir)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/upfluence/log/logtest"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/oci"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+const ecrRegistry = "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+
+func TestConfigLogins(t *testing.T) {
+	srv := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(
+				w,
+				`{"authorizationData":[{"authorizationToken":%q}]}`,
+				base64.StdEncoding.EncodeToString([]byte("AWS:ecr-pass")),
+			)
+		}),
+	)
+
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	fname := filepath.Join(t.TempDir(), "credentials.json")
+
+	require.NoError(
+		t,
+		os.WriteFile(fname, []byte(`{"ghcr.io":{"token":"ghs_xxx"},"quay.io":{"username":"bot"}}`), 0600),
+	)
+
+	var (
+		cctx = toolkit.CommandContext{
+			Logger:     logtest.WrapTestingLogger(t),
+			Repository: "upfluence/foo",
+		}
+
+		c = config{
+			Registries:              []string{"ghcr.io", "index.docker.io", "gcr.io", ecrRegistry},
+			RegistryUsername:        "bot",
+			RegistryPassword:        "dckr_pat",
+			RegistryCredentialsFile: fname,
+			LoginRegistries:         []string{"index.docker.io"},
+			ECREndpoint:             srv.URL,
+		}
+	)
+
+	ls, err := c.logins(context.Background(), cctx)
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]login{
+			{registry: "ghcr.io", cred: oci.Credential{Username: "upfluence", Password: "ghs_xxx"}},
+			{registry: "index.docker.io", cred: oci.Credential{Username: "bot", Password: "dckr_pat"}},
+			{registry: ecrRegistry, cred: oci.Credential{Username: "AWS", Password: "ecr-pass"}},
+		},
+		ls,
+	)
+
+	c.Registries = append(c.Registries, "quay.io")
+
+	_, err = c.logins(context.Background(), cctx)
+	assert.ErrorContains(t, err, "no password nor token for quay.io")
+}
+
+func TestBuilderLogin(t *testing.T) {
+	runnerConfig := t.TempDir()
+
+	t.Setenv("DOCKER_CONFIG", runnerConfig)
+
+	require.NoError(t, os.Mkdir(filepath.Join(runnerConfig, "cli-plugins"), 0755))
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(runnerConfig, "config.json"),
+			[]byte(`{"auths":{},"credsStore":"osxkeychain","credHelpers":{"ghcr.io":"gh","gcr.io":"gcloud"}}`),
+			0600,
+		),
+	)
+
+	var (
+		passwords []string
+
+		exc = fakeDocker(
+			dockerHandlers{
+				"login": func(cmd executil.Command) error {
+					buf, err := io.ReadAll(cmd.Stdin)
+					passwords = append(passwords, string(buf))
+
+					return err
+				},
+			},
+		)
+
+		bd = testBuilder(t, exc)
+	)
+
+	s, err := bd.login(
+		context.Background(),
+		[]login{
+			{registry: "ghcr.io", cred: oci.Credential{Username: "upfluence", Password: "ghs_xxx"}},
+			{registry: ecrRegistry, cred: oci.Credential{Username: "AWS", Password: "ecr-pass"}},
+		},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"ghs_xxx", "ecr-pass"}, passwords)
+
+	buf, err := os.ReadFile(filepath.Join(s.dir, "config.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"auths":{},"credHelpers":{"gcr.io":"gcloud"}}`, string(buf))
+
+	target, err := os.Readlink(filepath.Join(s.dir, "cli-plugins"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(runnerConfig, "cli-plugins"), target)
+
+	require.NoError(t, bd.docker(context.Background(), []string{"version"}))
+	require.NoError(t, bd.logout(s))
+
+	for _, cmd := range exc.Commands() {
+		assert.Equal(t, map[string]string{"DOCKER_CONFIG": s.dir}, cmd.Env)
+	}
+
+	assert.Equal(
+		t,
+		[][]string{
+			{"login", "--username", "upfluence", "--password-stdin", "ghcr.io"},
+			{"login", "--username", "AWS", "--password-stdin", ecrRegistry},
+			{"version"},
+		},
+		argsOf(exc),
+	)
+
+	assert.NoDirExists(t, s.dir)
+	assert.DirExists(t, filepath.Join(runnerConfig, "cli-plugins"))
+	assert.Nil(t, bd.env)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/upfluence/errors"
+	"github.com/upfluence/log"
+)
+
+// knownSecrets are the names that are never meant to be a build arg, build
+// args are recorded in the history of the image.
+var knownSecrets = []string{"GITHUB_TOKEN", "GH_TOKEN"}
+
+type secretArgPolicy int
+
+const (
+	warnSecretArg secretArgPolicy = iota
+	failSecretArg
+)
+
+func (p *secretArgPolicy) Parse(v string) error {
+	switch v {
+	case "warn":
+		*p = warnSecretArg
+	case "fail":
+		*p = failSecretArg
+	default:
+		return fmt.Errorf("Invalid secret-args %q", v)
+	}
+
+	return nil
+}
+
+// secret is mounted in the build by BuildKit out of the env var of the
+// docker CLI, i.e. RUN --mount=type=secret,id=GITHUB_TOKEN.
+type secret struct {
+	id  string
+	env string
+}
+
+func (s secret) flag() string {
+	return fmt.Sprintf("id=%s,env=%s", s.id, s.env)
+}
+
+func (c *config) secrets() []secret {
+	vs := c.ArgMode.secrets()
+
+	maps.Copy(vs, c.Secrets)
+
+	ss := make([]secret, 0, len(vs))
+
+	for _, id := range slices.Sorted(maps.Keys(vs)) {
+		ss = append(ss, secret{id: id, env: vs[id]})
+	}
+
+	return ss
+}
+
+// checkSecretArgs looks for secrets passed as build args, either by name or
+// by value.
+func (c *config) checkSecretArgs(l log.Logger, args map[string]string, ss []secret, token string) error {
+	names := slices.Clone(knownSecrets)
+
+	for _, s := range ss {
+		names = append(names, s.id, s.env)
+	}
+
+	var leaks []string
+
+	for _, k := range slices.Sorted(maps.Keys(args)) {
+		if slices.Contains(names, k) || (token != "" && args[k] == token) {
+			leaks = append(leaks, k)
+		}
+	}
+
+	if len(leaks) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf(
+		"build args %s hold secrets that are recorded in the image history, use secrets instead",
+		strings.Join(leaks, ", "),
+	)
+
+	if c.SecretArgPolicy == failSecretArg {
+		return errors.New(msg)
+	}
+
+	l.Warning(msg)
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/upfluence/errors"
+	"github.com/upfluence/log"
+)
+
+// dockerfileSettings overrides the defaults of the dockerfiles matching
+// Dockerfile, a path or a glob. Args are added to the build args, the other
+// fields replace the default value when set.
+type dockerfileSettings struct {
+	Dockerfile string            `json:"dockerfile"`
+	Context    string            `json:"context"`
+	Target     string            `json:"target"`
+	Args       map[string]string `json:"args"`
+	Name       string            `json:"name"`
+	Platforms  []string          `json:"platforms"`
+}
+
+func (s dockerfileSettings) match(fname string) (bool, error) {
+	ok, err := filepath.Match(filepath.Clean(s.Dockerfile), fname)
+
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid dockerfile glob %q", s.Dockerfile)
+	}
+
+	return ok, nil
+}
+
+func parseDockerfileSettings(buf []byte) ([]dockerfileSettings, error) {
+	var ss []dockerfileSettings
+
+	if err := json.Unmarshal(buf, &ss); err != nil {
+		return nil, err
+	}
+
+	for i, s := range ss {
+		if s.Dockerfile == "" {
+			return nil, fmt.Errorf("entry %d has no dockerfile", i)
+		}
+	}
+
+	return ss, nil
+}
+
+// dockerfileSettings returns the entries of the build manifest followed by
+// the ones of the dockerfile-settings input, so the input has the last word.
+func (c *config) dockerfileSettings() ([]dockerfileSettings, error) {
+	var ss []dockerfileSettings
+
+	if c.BuildManifest != "" {
+		buf, err := os.ReadFile(c.BuildManifest)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "cant read the build manifest")
+		}
+
+		fss, err := parseDockerfileSettings(buf)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid build manifest %q", c.BuildManifest)
+		}
+
+		ss = fss
+	}
+
+	if c.DockerfileSettings != "" {
+		iss, err := parseDockerfileSettings([]byte(c.DockerfileSettings))
+
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid dockerfile-settings")
+		}
+
+		ss = append(ss, iss...)
+	}
+
+	return ss, nil
+}
+
+// settingsFor merges the entries matching fname in order.
+func settingsFor(ss []dockerfileSettings, fname string, matched []bool) (dockerfileSettings, error) {
+	res := dockerfileSettings{Dockerfile: fname, Args: make(map[string]string)}
+
+	for i, s := range ss {
+		ok, err := s.match(fname)
+
+		if err != nil {
+			return res, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		matched[i] = true
+
+		if s.Context != "" {
+			res.Context = s.Context
+		}
+
+		if s.Target != "" {
+			res.Target = s.Target
+		}
+
+		if s.Name != "" {
+			res.Name = s.Name
+		}
+
+		if len(s.Platforms) > 0 {
+			res.Platforms = s.Platforms
+		}
+
+		maps.Copy(res.Args, s.Args)
+	}
+
+	return res, nil
+}
+
+// buildContext checks the context directory of the build, and returns the
+// .dockerignore applied to it: BuildKit reads <dockerfile>.dockerignore
+// next to the Dockerfile first, then the .dockerignore at the root of the
+// context.
+func buildContext(l log.Logger, dir, dockerfile string) (string, error) {
+	fi, err := os.Stat(dir)
+
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid context of %s", dockerfile)
+	}
+
+	if !fi.IsDir() {
+		return "", fmt.Errorf("context %q of %s is not a directory", dir, dockerfile)
+	}
+
+	for _, fname := range []string{dockerfile + ".dockerignore", filepath.Join(dir, ".dockerignore")} {
+		if _, err := os.Stat(fname); err == nil {
+			return fname, nil
+		}
+	}
+
+	if filepath.Clean(dir) != "." {
+		if _, err := os.Stat(".dockerignore"); err == nil {
+			l.Warningf(
+				"The .dockerignore at the root of the repository does not apply to %s, its context is %s",
+				dockerfile,
+				dir,
+			)
+		}
+	}
+
+	return "", nil
+}
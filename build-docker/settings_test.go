@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/upfluence/log/logtest"
+)
+
+func TestSettingsFor(t *testing.T) {
+	ss, err := parseDockerfileSettings(
+		[]byte(`[
+  {"dockerfile": "images/*/Dockerfile", "platforms": ["linux/amd64", "linux/arm64"], "args": {"A": "1", "B": "1"}},
+  {"dockerfile": "./images/app/Dockerfile", "context": "images", "target": "release", "args": {"B": "2"}},
+  {"dockerfile": "images/app/Dockerfile", "name": "upfluence/app-server"},
+  {"dockerfile": "Dockerfile.dev"}
+]`),
+	)
+	require.NoError(t, err)
+
+	matched := make([]bool, len(ss))
+
+	s, err := settingsFor(ss, "images/app/Dockerfile", matched)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		dockerfileSettings{
+			Dockerfile: "images/app/Dockerfile",
+			Context:    "images",
+			Target:     "release",
+			Args:       map[string]string{"A": "1", "B": "2"},
+			Name:       "upfluence/app-server",
+			Platforms:  []string{"linux/amd64", "linux/arm64"},
+		},
+		s,
+	)
+
+	s, err = settingsFor(ss, "Dockerfile", matched)
+	require.NoError(t, err)
+	assert.Equal(t, dockerfileSettings{Dockerfile: "Dockerfile", Args: map[string]string{}}, s)
+
+	assert.Equal(t, []bool{true, true, true, false}, matched)
+
+	_, err = parseDockerfileSettings([]byte(`[{"context": "images"}]`))
+	assert.ErrorContains(t, err, "entry 0 has no dockerfile")
+
+	_, err = settingsFor([]dockerfileSettings{{Dockerfile: "["}}, "Dockerfile", matched)
+	assert.Error(t, err)
+}
+
+func TestBuildContext(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		l   = logtest.WrapTestingLogger(t)
+
+		app    = writeDockerfile(t, dir, "app", "FROM alpine\n")
+		worker = writeDockerfile(t, dir, "worker", "FROM alpine\n")
+	)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("*.md\n"), 0644))
+	require.NoError(t, os.WriteFile(app+".dockerignore", []byte("node_modules\n"), 0644))
+
+	ignore, err := buildContext(l, dir, app)
+	require.NoError(t, err)
+	assert.Equal(t, app+".dockerignore", ignore)
+
+	ignore, err = buildContext(l, dir, worker)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, ".dockerignore"), ignore)
+
+	ignore, err = buildContext(l, filepath.Dir(worker), worker)
+	require.NoError(t, err)
+	assert.Empty(t, ignore)
+
+	_, err = buildContext(l, filepath.Join(dir, "missing"), app)
+	assert.Error(t, err)
+
+	_, err = buildContext(l, app, app)
+	assert.ErrorContains(t, err, "is not a directory")
+}
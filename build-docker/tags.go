@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+var (
+	pullRequestRefRegexp = regexp.MustCompile(`^refs/pull/([0-9]+)/`)
+	invalidTagCharRegexp = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+// sanitizeTag turns v into a valid docker tag, i.e. a branch name such as
+// feature/foo becomes feature-foo.
+func sanitizeTag(v string) string {
+	v = strings.TrimLeft(invalidTagCharRegexp.ReplaceAllString(v, "-"), ".-")
+
+	if len(v) > 128 {
+		v = v[:128]
+	}
+
+	return v
+}
+
+// branchTag is the tag of the app preset following the branch, latest on
+// main and master.
+const branchTag = `{{ if or (eq .Branch "main") (eq .Branch "master") }}latest{{ else }}{{ .Branch }}{{ end }}`
+
+type tagMode int
+
+func (tm *tagMode) Parse(v string) error {
+	switch v {
+	case "app":
+		*tm = app
+	case "none":
+		*tm = none
+	default:
+		return fmt.Errorf("Invalid tag-mode %q", v)
+	}
+
+	return nil
+}
+
+func (tm tagMode) templates() []string {
+	switch tm {
+	case app:
+		return []string{"{{ .Version }}", branchTag, "{{ .ShortSha }}"}
+	default:
+		return nil
+	}
+}
+
+type tagTemplate struct {
+	t *template.Template
+}
+
+func (tt *tagTemplate) Parse(v string) error {
+	var err error
+
+	tt.t, err = template.New(v).Option("missingkey=error").Parse(v)
+
+	return err
+}
+
+func (tt tagTemplate) render(tc tagContext) (string, error) {
+	var buf bytes.Buffer
+
+	if err := tt.t.Execute(&buf, tc); err != nil {
+		return "", errors.Wrapf(err, "cant render the tag template %q", tt.t.Name())
+	}
+
+	return buf.String(), nil
+}
+
+// tagContext is the data of the tag templates. The semver parts are empty
+// when the version is not a semver, PullRequest is 0 out of pull requests.
+type tagContext struct {
+	Version    string
+	Major      string
+	Minor      string
+	Patch      string
+	Prerelease string
+	Metadata   string
+
+	Branch      string
+	Sha         string
+	ShortSha    string
+	PullRequest int
+
+	Time      time.Time
+	Timestamp string
+}
+
+// branch is the branch being built, pull requests are built out of
+// refs/pull/<n>/merge.
+func branch(cctx toolkit.CommandContext) string {
+	if cctx.HeadRef != "" {
+		return cctx.HeadRef
+	}
+
+	return cctx.RefName
+}
+
+func newTagContext(cctx toolkit.CommandContext, v string, now time.Time) tagContext {
+	now = now.UTC()
+
+	tc := tagContext{
+		Version:   v,
+		Branch:    sanitizeTag(branch(cctx)),
+		Sha:       cctx.Sha,
+		ShortSha:  cctx.Sha[:min(7, len(cctx.Sha))],
+		Time:      now,
+		Timestamp: now.Format("20060102150405"),
+	}
+
+	if sv, err := parseVersion(v); err == nil {
+		tc.Major = strconv.FormatInt(sv.Major(), 10)
+		tc.Minor = strconv.FormatInt(sv.Minor(), 10)
+		tc.Patch = strconv.FormatInt(sv.Patch(), 10)
+		tc.Prerelease = sv.Prerelease()
+		tc.Metadata = sv.Metadata()
+	}
+
+	if m := pullRequestRefRegexp.FindStringSubmatch(cctx.Ref); m != nil {
+		tc.PullRequest, _ = strconv.Atoi(m[1])
+	}
+
+	return tc
+}
+
+// tags renders the templates of the tag mode, then the tag templates and
+// appends the extra and additional tags. Tags are sanitized to the docker
+// grammar, empty ones are dropped and duplicates removed.
+func (c *config) tags(tc tagContext, extra ...string) ([]string, error) {
+	var vs []string
+
+	for _, v := range c.TagMode.templates() {
+		var tt tagTemplate
+
+		if err := tt.Parse(v); err != nil {
+			return nil, err
+		}
+
+		t, err := tt.render(tc)
+
+		if err != nil {
+			return nil, err
+		}
+
+		vs = append(vs, t)
+	}
+
+	for _, tt := range c.TagTemplates {
+		t, err := tt.render(tc)
+
+		if err != nil {
+			return nil, err
+		}
+
+		vs = append(vs, t)
+	}
+
+	var tags []string
+
+	vs = append(vs, extra...)
+
+	for _, v := range append(vs, c.AdditionalTags...) {
+		if t := sanitizeTag(strings.TrimSpace(v)); t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+
+	return tags, nil
+}
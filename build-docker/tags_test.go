@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+func TestSanitizeTag(t *testing.T) {
+	for in, want := range map[string]string{
+		"main":            "main",
+		"feature/foo_bar": "feature-foo_bar",
+		"-dependabot/x":   "dependabot-x",
+		"v1.0.0+build":    "v1.0.0-build",
+	} {
+		assert.Equal(t, want, sanitizeTag(in), in)
+	}
+}
+
+func TestConfigTags(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name      string
+		c         config
+		templates []string
+		cctx      toolkit.CommandContext
+
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "app on main",
+			c:    config{TagMode: app, Version: "v1.4.2", AdditionalTags: []string{"latest", "stable"}},
+			cctx: toolkit.CommandContext{RefName: "main", Sha: "0123456789"},
+			want: []string{"v1.4.2", "latest", "0123456", "stable"},
+		},
+		{
+			name: "app on a branch",
+			c:    config{TagMode: app, Version: "v1.4.3-rc1+build_12"},
+			cctx: toolkit.CommandContext{RefName: "feature/foo", Sha: "0123456789"},
+			want: []string{"v1.4.3-rc1-build_12", "feature-foo", "0123456"},
+		},
+		{
+			name: "templates",
+			c:    config{Version: "v1.4.2"},
+			templates: []string{
+				"{{ .Major }}.{{ .Minor }}",
+				"{{ with .PullRequest }}pr-{{ . }}{{ end }}",
+				"{{ .Branch }}-{{ .Timestamp }}",
+				"{{ .Major }}.{{ .Minor }}",
+			},
+			cctx: toolkit.CommandContext{
+				Ref:     "refs/pull/12/merge",
+				RefName: "12/merge",
+				HeadRef: "dependabot/go_modules/foo",
+				Sha:     "0123456789",
+			},
+			want: []string{"1.4", "pr-12", "dependabot-go_modules-foo-20240102030405"},
+		},
+		{
+			name:      "not a semver",
+			c:         config{Version: "nightly"},
+			templates: []string{"{{ .Major }}.{{ .Minor }}", "{{ .Version }}"},
+			cctx:      toolkit.CommandContext{RefName: "main", Sha: "0123456789"},
+			want:      []string{"nightly"},
+		},
+		{
+			name:      "unknown field",
+			templates: []string{"{{ .Tag }}"},
+			cctx:      toolkit.CommandContext{RefName: "main", Sha: "0123456789"},
+			wantErr:   true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, v := range tt.templates {
+				var tpl tagTemplate
+
+				require.NoError(t, tpl.Parse(v))
+				tt.c.TagTemplates = append(tt.c.TagTemplates, tpl)
+			}
+
+			tags, err := tt.c.tags(newTagContext(tt.cctx, tt.c.Version, now))
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, tags)
+		})
+	}
+}
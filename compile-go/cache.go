@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+const cacheFilename = ".compile-go-cache.json"
+
+var moduleFiles = []string{"go.mod", "go.sum"}
+
+type cacheEntry struct {
+	Key    string `json:"key"`
+	Sha256 string `json:"sha256"`
+
+	// Packed binaries can not be inspected anymore, their sizes are kept
+	// from the time they were built.
+	Packed bool         `json:"packed,omitempty"`
+	Sizes  *binarySizes `json:"sizes,omitempty"`
+}
+
+type buildCache struct {
+	path    string
+	entries map[string]cacheEntry
+
+	// used holds the entries of the binaries built in this run, the others
+	// are dropped when saving.
+	used map[string]struct{}
+}
+
+func loadBuildCache(distDir string) (*buildCache, error) {
+	bc := buildCache{
+		path:    filepath.Join(distDir, cacheFilename),
+		entries: make(map[string]cacheEntry),
+		used:    make(map[string]struct{}),
+	}
+
+	buf, err := os.ReadFile(bc.path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return &bc, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "cant read %q", bc.path)
+	}
+
+	if err := json.Unmarshal(buf, &bc.entries); err != nil {
+		return nil, errors.Wrapf(err, "cant decode %q", bc.path)
+	}
+
+	return &bc, nil
+}
+
+func (bc *buildCache) lookup(filename, name, key string) (string, bool) {
+	bc.used[name] = struct{}{}
+
+	e, ok := bc.entries[name]
+
+	if !ok || e.Key != key {
+		return "", false
+	}
+
+	sum, err := hashFile(filename)
+
+	if err != nil || sum != e.Sha256 {
+		return "", false
+	}
+
+	return sum, true
+}
+
+func (bc *buildCache) store(name, key, sum string) {
+	bc.used[name] = struct{}{}
+	bc.entries[name] = cacheEntry{Key: key, Sha256: sum}
+}
+
+func (bc *buildCache) update(name string, fn func(*cacheEntry)) {
+	e := bc.entries[name]
+	fn(&e)
+	bc.entries[name] = e
+	bc.used[name] = struct{}{}
+}
+
+func (bc *buildCache) save() error {
+	maps.DeleteFunc(
+		bc.entries,
+		func(name string, _ cacheEntry) bool {
+			_, ok := bc.used[name]
+			return !ok
+		},
+	)
+
+	buf, err := json.MarshalIndent(bc.entries, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(
+		os.WriteFile(bc.path, buf, 0644),
+		"cant write %q",
+		bc.path,
+	)
+}
+
+type listedPackage struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	Standard   bool
+	Match      []string
+
+	Error *struct {
+		Err string
+	}
+
+	Module *struct {
+		Path    string
+		Version string
+		Dir     string
+		GoMod   string
+		Main    bool
+	}
+
+	GoFiles    []string
+	CgoFiles   []string
+	CFiles     []string
+	CXXFiles   []string
+	HFiles     []string
+	SFiles     []string
+	EmbedFiles []string
+	SysoFiles  []string
+}
+
+func (lp listedPackage) files() []string {
+	var fs []string
+
+	for _, vs := range [][]string{
+		lp.GoFiles,
+		lp.CgoFiles,
+		lp.CFiles,
+		lp.CXXFiles,
+		lp.HFiles,
+		lp.SFiles,
+		lp.EmbedFiles,
+		lp.SysoFiles,
+	} {
+		fs = append(fs, vs...)
+	}
+
+	return fs
+}
+
+func (c *compiler) listDeps(ctx context.Context, b build, env map[string]string) ([]listedPackage, error) {
+	var buf bytes.Buffer
+
+	if err := c.executor.Exec(
+		ctx,
+		executil.Command{
+			Cmd:    c.path,
+			Args:   append(append([]string{"list", "-deps", "-json"}, c.tagArgs()...), "./"+b.Path),
+			Env:    env,
+			Stdout: &buf,
+		},
+	); err != nil {
+		return nil, errors.Wrapf(err, "cant list dependencies of %q", b.Path)
+	}
+
+	var (
+		pkgs []listedPackage
+
+		dec = json.NewDecoder(&buf)
+	)
+
+	for dec.More() {
+		var pkg listedPackage
+
+		if err := dec.Decode(&pkg); err != nil {
+			return nil, errors.Wrap(err, "cant decode go list output")
+		}
+
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs, nil
+}
+
+func hashFileInto(w io.Writer, fname string) error {
+	f, err := os.Open(fname)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	fmt.Fprintf(w, "file %s\n", fname)
+	_, err = io.Copy(w, f)
+
+	return err
+}
+
+// cacheKey digests everything that may alter the output of cmd: the build
+// command itself, its environment, whether the binary gets packed, the
+// module files and the content of every package of the dependency closure
+// living outside of the module cache (which is already pinned by go.sum).
+func (c *compiler) cacheKey(ctx context.Context, b build, cmd executil.Command) (string, error) {
+	pkgs, err := c.listDeps(ctx, b, cmd.Env)
+
+	if err != nil {
+		return "", err
+	}
+
+	if c.goEnv == "" {
+		out, err := c.output(ctx, nil, "env", "GOVERSION", "GOROOT")
+
+		if err != nil {
+			return "", errors.Wrap(err, "cant read the go toolchain")
+		}
+
+		c.goEnv = strings.Join(strings.Fields(out), " ")
+	}
+
+	h := sha256.New()
+
+	fmt.Fprintf(h, "toolchain %s\n", c.goEnv)
+	fmt.Fprintf(h, "upx %t\n", c.upx)
+	fmt.Fprintf(h, "cmd %s %q\n", cmd.Cmd, cmd.Args)
+
+	for _, k := range slices.Sorted(maps.Keys(cmd.Env)) {
+		fmt.Fprintf(h, "env %s=%s\n", k, cmd.Env[k])
+	}
+
+	fnames := append(slices.Clone(moduleFiles), workspaceFiles...)
+
+	for _, pkg := range pkgs {
+		// the go.mod of every workspace module the build depends on
+		if m := pkg.Module; m != nil && m.Version == "" && m.GoMod != "" {
+			for _, fname := range []string{m.GoMod, filepath.Join(m.Dir, "go.sum")} {
+				if !slices.Contains(fnames, fname) {
+					fnames = append(fnames, fname)
+				}
+			}
+		}
+	}
+
+	for _, fname := range fnames {
+		if err := hashFileInto(h, fname); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", errors.Wrapf(err, "cant hash %q", fname)
+		}
+	}
+
+	for _, pkg := range pkgs {
+		switch {
+		case pkg.Standard:
+			fmt.Fprintf(h, "std %s %s\n", pkg.ImportPath, pkg.Dir)
+		case pkg.Module != nil && pkg.Module.Version != "":
+			fmt.Fprintf(h, "mod %s %s@%s\n", pkg.ImportPath, pkg.Module.Path, pkg.Module.Version)
+		default:
+			for _, f := range pkg.files() {
+				if err := hashFileInto(h, filepath.Join(pkg.Dir, f)); err != nil {
+					return "", errors.Wrapf(err, "cant hash sources of %q", pkg.ImportPath)
+				}
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type buildReport struct {
+	build    build
+	filename string
+	skipped  bool
+}
+
+func (c *compiler) writeReport(cctx toolkit.CommandContext) error {
+	var (
+		built, skipped int
+
+		rows [][]string
+	)
+
+	for _, r := range c.report {
+		status := "built"
+
+		if r.skipped {
+			status = "skipped (up to date)"
+			skipped++
+		} else {
+			built++
+		}
+
+		rows = append(rows, []string{r.filename, r.build.archKey(), status})
+	}
+
+	cctx.Logger.Noticef("Built %d target(s), skipped %d up to date target(s)", built, skipped)
+
+	return writeTable(cctx.StepSummary, []string{"Binary", "Target", "Status"}, rows)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+func TestCompilerCache(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		cctx = testCommandContext(t)
+		src  = t.TempDir()
+
+		c = config{
+			ExecutablePaths: []string{"."},
+			DistDir:         t.TempDir(),
+			OSs:             []string{"linux"},
+			Archs:           []string{"amd64"},
+			CompilerPath:    "go",
+		}
+	)
+
+	require.NoError(t, c.NameTemplate.Parse("foo"))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "main.go"), []byte("package main"), 0644))
+
+	goVersion := "go1.22.0"
+
+	exc := fakeExecutorWith(
+		execHandlers{
+			"env": func(cmd executil.Command) error {
+				_, err := fmt.Fprintf(cmd.Stdout, "%s\n/goroot\n", goVersion)
+				return err
+			},
+			"list": printOutput(
+				fmt.Sprintf(
+					`{"ImportPath":"fmt","Dir":"/goroot/src/fmt","Standard":true}
+{"ImportPath":"github.com/foo/bar","Module":{"Path":"github.com/foo/bar","Version":"v1.0.0"}}
+{"ImportPath":"foo","Dir":%q,"GoFiles":["main.go"]}`,
+					src,
+				),
+			),
+		},
+	)
+
+	bs, err := c.builds(cctx, []executable{{Path: "."}})
+	require.NoError(t, err)
+
+	compile := func(c config) []buildReport {
+		cp, err := newCompiler(c, cctx)
+		require.NoError(t, err)
+
+		cp.executor = exc
+
+		for _, b := range bs {
+			_, sum, err := cp.execute(ctx, b, cctx)
+			require.NoError(t, err)
+			assert.NotEmpty(t, sum)
+		}
+
+		require.NoError(t, cp.cache.save())
+
+		return cp.report
+	}
+
+	assert.False(t, compile(c)[0].skipped)
+	assert.True(t, compile(c)[0].skipped)
+
+	c.Force = true
+	assert.False(t, compile(c)[0].skipped)
+	c.Force = false
+
+	require.NoError(t, os.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n"), 0644))
+	assert.False(t, compile(c)[0].skipped)
+
+	require.NoError(t, os.WriteFile(filepath.Join(c.DistDir, "foo"), []byte("tampered"), 0755))
+	assert.False(t, compile(c)[0].skipped)
+
+	goVersion = "go1.23.0"
+	assert.False(t, compile(c)[0].skipped)
+	assert.True(t, compile(c)[0].skipped)
+
+	assert.Len(t, commandsOf(exc, "build"), 5)
+}
+
+func TestBuildCacheSavePrunes(t *testing.T) {
+	dir := t.TempDir()
+
+	bc, err := loadBuildCache(dir)
+	require.NoError(t, err)
+
+	bc.store("foo-v1.0.0", "key", "sum")
+	bc.store("foo-v1.1.0", "key", "sum")
+	require.NoError(t, bc.save())
+
+	bc, err = loadBuildCache(dir)
+	require.NoError(t, err)
+
+	bc.store("foo-v1.2.0", "key", "sum")
+	bc.update("foo-v1.1.0", func(e *cacheEntry) { e.Packed = true })
+	require.NoError(t, bc.save())
+
+	bc, err = loadBuildCache(dir)
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		map[string]cacheEntry{
+			"foo-v1.1.0": {Key: "key", Sha256: "sum", Packed: true},
+			"foo-v1.2.0": {Key: "key", Sha256: "sum"},
+		},
+		bc.entries,
+	)
+}
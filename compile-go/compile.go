@@ -8,66 +8,34 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/upfluence/errors"
 	"github.com/upfluence/log"
 	"github.com/upfluence/log/record"
 
+	"github.com/upfluence/actions/pkg/definitions"
 	"github.com/upfluence/actions/pkg/executil"
 	"github.com/upfluence/actions/pkg/toolkit"
 )
 
-type linkerMode int
-
-const (
-	none linkerMode = iota
-	pkg
-	cli
-)
-
-func (lm *linkerMode) Parse(v string) error {
-	switch v {
-	case "pkg":
-		*lm = pkg
-	case "cli":
-		*lm = cli
-	case "none":
-		*lm = none
-	default:
-		return fmt.Errorf("Invalid linker-mode %q", v)
-	}
-
-	return nil
-}
-
-func (lm linkerMode) links(cctx toolkit.CommandContext, v string) map[string]string {
-	switch lm {
-	case pkg:
-		return map[string]string{
-			"github.com/upfluence/pkg/peer.Version":   v,
-			"github.com/upfluence/pkg/peer.GitCommit": cctx.Sha,
-			"github.com/upfluence/pkg/peer.GitBranch": cctx.RefName,
-			"github.com/upfluence/pkg/peer.GitRemote": "https://github.com/" + cctx.Repository,
-		}
-	case cli:
-		return map[string]string{
-			"github.com/upfluence/cfg/x/cli.Version": v,
-		}
-	}
-
-	return make(map[string]string)
-}
-
 type nameTemplate struct {
 	t *template.Template
 }
 
 func (nt *nameTemplate) Parse(v string) error {
+	if v == "" {
+		nt.t = nil
+		return nil
+	}
+
 	var err error
 
 	nt.t, err = template.New("").Parse(v)
@@ -77,22 +45,72 @@ func (nt *nameTemplate) Parse(v string) error {
 
 func (nt nameTemplate) render(b build) (string, error) {
 	if nt.t == nil {
-		return b.Name(), nil
+		return b.Name() + b.Ext(), nil
 	}
 
 	var buf bytes.Buffer
 
-	err := nt.t.Execute(&buf, b)
+	if err := nt.t.Execute(&buf, b); err != nil {
+		return "", err
+	}
+
+	name := buf.String()
+
+	if ext := b.Ext(); !strings.HasSuffix(name, ext) {
+		name += ext
+	}
+
+	return name, nil
+}
+
+// checkCollisions renders the name of every build and fails if two of them
+// would end up written at the same location in the dist dir.
+func (nt nameTemplate) checkCollisions(bs []build) error {
+	var (
+		collisions []string
+
+		targets = make(map[string][]string)
+	)
+
+	for _, b := range bs {
+		name, err := nt.render(b)
+
+		if err != nil {
+			return errors.Wrapf(err, "cant render the name of %s (%s)", b.Name(), b.archKey())
+		}
+
+		targets[name] = append(targets[name], b.Path+"@"+b.archKey())
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(targets)) {
+		if ts := targets[name]; len(ts) > 1 {
+			collisions = append(
+				collisions,
+				fmt.Sprintf("%s (%s)", name, strings.Join(ts, ", ")),
+			)
+		}
+	}
+
+	if len(collisions) > 0 {
+		return fmt.Errorf(
+			"name-template renders the same filename for several builds: %s",
+			strings.Join(collisions, "; "),
+		)
+	}
 
-	return buf.String(), err
+	return nil
 }
 
 type build struct {
-	Path string
+	Path   string
+	Module goModule
 
 	Version string
 	OS      string
 	Arch    string
+
+	toolchain cToolchain
+	links     map[string]string
 }
 
 func (b build) archKey() string { return fmt.Sprintf("%s/%s", b.OS, b.Arch) }
@@ -101,16 +119,25 @@ func (b build) Name() string {
 	return filepath.Base(b.Path)
 }
 
+func (b build) Ext() string {
+	if b.OS == "windows" {
+		return ".exe"
+	}
+
+	return ""
+}
+
 var defaultConfig = config{
 	ExecutablePaths: []string{"."},
 	DistDir:         "dist/",
 	OSs:             []string{"linux"},
 	Archs:           []string{"amd64"},
-	LinkerMode:      none,
+	LinkerMode:      "none",
 }
 
 type config struct {
 	Version         string            `flag:"release-version"`
+	ModuleVersions  map[string]string `flag:"module-versions"`
 	ExecutablePaths []string          `flag:"executable-paths"`
 	DistDir         string            `flag:"dist-dir"`
 	OSs             []string          `flag:"oss"`
@@ -119,62 +146,127 @@ type config struct {
 	LinkerMode      linkerMode        `flag:"linker-mode"`
 	AdditionalLinks map[string]string `flag:"additional-links"`
 	CompilerPath    string            `flag:"compiler-path"`
+	GoVersion       string            `flag:"go-version"`
+	GoToolchainDir  string            `flag:"go-toolchain-dir"`
+	GoMirror        string            `flag:"go-mirror"`
 	NameTemplate    nameTemplate      `flag:"name-template"`
 	CompilerTags    []string          `flag:"compiler-tags"`
+
+	CC                 map[string]string           `flag:"cc"`
+	CXX                map[string]string           `flag:"cxx"`
+	CGoCFlags          map[string]string           `flag:"cgo-cflags"`
+	CGoLDFlags         map[string]string           `flag:"cgo-ldflags"`
+	CToolchains        map[string]cToolchainPreset `flag:"c-toolchains"`
+	DynamicLinkTargets []string                    `flag:"dynamic-link-targets"`
+
+	UniversalBinaries bool `flag:"universal-binaries"`
+
+	Force bool `flag:"force"`
+
+	SBOMFormats []sbomFormat `flag:"sbom-formats"`
+
+	ValidateLinks   bool  `flag:"validate-links"`
+	SourceDateEpoch int64 `env:"SOURCE_DATE_EPOCH"`
+
+	Verify       bool            `flag:"verify"`
+	SmokeCommand commandTemplate `flag:"smoke-command"`
+
+	Completions       []shell         `flag:"completions"`
+	CompletionCommand commandTemplate `flag:"completion-command"`
+	ManPages          bool            `flag:"man-pages"`
+	ManCommand        commandTemplate `flag:"man-command"`
+
+	UPX              bool         `flag:"upx"`
+	SizeBudget       float64      `flag:"size-budget"`
+	SizeBudgetAction budgetAction `flag:"size-budget-action"`
+
+	Vet  bool `flag:"vet"`
+	Test bool `flag:"test"`
+	Race bool `flag:"race"`
+
+	WindowsResources   bool   `flag:"windows-resources"`
+	WindowsProductName string `flag:"windows-product-name"`
+	WindowsCompanyName string `flag:"windows-company-name"`
+	WindowsIcon        string `flag:"windows-icon"`
+
+	ImageName             nameTemplate      `flag:"image-name"`
+	ImageBase             string            `flag:"image-base"`
+	ImageTags             []string          `flag:"image-tags"`
+	ImageLabels           map[string]string `flag:"image-labels"`
+	ImagePush             bool              `flag:"image-push"`
+	ImageRegistryUsername string            `flag:"image-registry-username"`
+	ImageRegistryPassword string            `env:"IMAGE_REGISTRY_PASSWORD"`
+
+	DefinitionsFormat definitions.Format `flag:"definitions-format"`
 }
 
-func (c config) executablePaths(_ toolkit.CommandContext) ([]string, error) {
+func (c config) executablePaths() ([]string, error) {
 	var paths []string
 
 	for _, exc := range c.ExecutablePaths {
+		if isPattern(exc) || isExclusion(exc) {
+			continue
+		}
+
 		fnames, err := filepath.Glob(filepath.Join(".", exc))
 
 		if err != nil {
 			return nil, errors.Wrapf(err, "invalid glob %q", exc)
 		}
 
-		paths = append(paths, fnames...)
+		for _, fname := range fnames {
+			// only directories may hold a package
+			if fi, err := os.Stat(fname); err == nil && fi.IsDir() {
+				paths = append(paths, fname)
+			}
+		}
 	}
 
 	return paths, nil
 }
 
-func (c config) builds(cctx toolkit.CommandContext) ([]build, error) {
-	ps, err := c.executablePaths(cctx)
+func (c config) builds(cctx toolkit.CommandContext, exes []executable) ([]build, error) {
+	var (
+		bs  []build
+		err error
 
-	if err != nil {
-		return nil, err
-	}
+		links = make(map[goModule]map[string]string)
+	)
 
-	var bs []build
+	for _, exe := range exes {
+		ls, ok := links[exe.Module]
 
-	for _, p := range ps {
-		for _, os := range c.OSs {
-			for _, arch := range c.Archs {
-				bs = append(
-					bs,
-					build{
-						Path:    p,
-						Version: c.Version,
-						OS:      os,
-						Arch:    arch,
-					},
-				)
+		if !ok {
+			if ls, err = c.links(cctx, exe.Module); err != nil {
+				return nil, err
 			}
+
+			links[exe.Module] = ls
 		}
-	}
 
-	return bs, nil
-}
+		for _, os := range c.OSs {
+			for _, arch := range c.Archs {
+				b := build{
+					Path:    exe.Path,
+					Module:  exe.Module,
+					Version: c.moduleVersion(exe.Module),
+					OS:      os,
+					Arch:    arch,
+					links:   ls,
+				}
 
-func (c config) links(cctx toolkit.CommandContext) map[string]string {
-	ls := c.LinkerMode.links(cctx, c.Version)
+				if c.CGo {
+					if b.toolchain, err = c.cToolchain(b.archKey()); err != nil {
+						return nil, err
+					}
+				}
 
-	for k, v := range c.AdditionalLinks {
-		ls[k] = v
+				bs = append(bs, b)
+			}
+		}
 	}
 
-	return ls
+	return bs, nil
 }
 
 func (c config) compilerPath() (string, error) {
@@ -201,12 +293,30 @@ type compiler struct {
 	distDir string
 	cgo     bool
 
-	links        map[string]string
 	compilerTags []string
 
 	nt nameTemplate
 
 	repo string
+
+	cache  *buildCache
+	force  bool
+	goEnv  string
+	report []buildReport
+
+	sbomFormats []sbomFormat
+	sbomCreated time.Time
+
+	validateLinks  bool
+	verifyBinaries bool
+	smokeCommand   commandTemplate
+
+	upx   bool
+	sizes []sizeReport
+
+	goVersion string
+
+	windows windowsResources
 }
 
 func newCompiler(c config, cctx toolkit.CommandContext) (*compiler, error) {
@@ -216,84 +326,145 @@ func newCompiler(c config, cctx toolkit.CommandContext) (*compiler, error) {
 		return nil, err
 	}
 
+	bc, err := loadBuildCache(c.DistDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	wr, err := c.windowsResources()
+
+	if err != nil {
+		return nil, err
+	}
+
+	created := time.Now()
+
+	if c.SourceDateEpoch > 0 {
+		created = time.Unix(c.SourceDateEpoch, 0)
+	}
+
 	return &compiler{
 		path:         p,
 		executor:     c.executor(cctx.Logger),
 		distDir:      c.DistDir,
 		cgo:          c.CGo,
-		links:        c.links(cctx),
 		compilerTags: c.CompilerTags,
 		nt:           c.NameTemplate,
 		repo:         cctx.Repository,
+		cache:        bc,
+		force:        c.Force,
+		sbomFormats:  c.SBOMFormats,
+		sbomCreated:  created,
+
+		validateLinks:  c.ValidateLinks,
+		verifyBinaries: c.Verify,
+		smokeCommand:   c.SmokeCommand,
+
+		upx: c.UPX,
+
+		windows: wr,
 	}, nil
 }
 
-func (c *compiler) execute(ctx context.Context, b build, cctx toolkit.CommandContext) (string, string, error) {
-	t, err := c.nt.render(b)
+func (c *compiler) env(b build) map[string]string {
+	env := map[string]string{
+		"GOOS":        b.OS,
+		"GOARCH":      b.Arch,
+		"CGO_ENABLED": "0",
+	}
 
-	if err != nil {
-		return "", "", err
+	if c.cgo {
+		env["CGO_ENABLED"] = "1"
+
+		for k, v := range b.toolchain.env() {
+			env[k] = v
+		}
 	}
 
+	return env
+}
+
+func (c *compiler) ldFlags(b build) string {
 	ldFlags := []string{"-s"}
-	formattedTags := ""
 
-	for k, v := range c.links {
-		ldFlags = append(ldFlags, fmt.Sprintf("-X %s=%s", k, v))
+	for _, k := range slices.Sorted(maps.Keys(b.links)) {
+		ldFlags = append(ldFlags, fmt.Sprintf("-X %s=%s", k, b.links[k]))
 	}
 
-	if len(c.compilerTags) > 0 {
-		formattedTags = fmt.Sprintf("-tags='%s'", strings.Join(c.compilerTags, " "))
+	if c.cgo && b.toolchain.Static {
+		ldFlags = append(ldFlags, "-linkmode external -extldflags \"-static\"")
 	}
 
-	cgoStr := "0"
+	return strings.Join(ldFlags, " ")
+}
 
-	if c.cgo {
-		cgoStr = "1"
+func (c *compiler) tagArgs() []string {
+	if len(c.compilerTags) == 0 {
+		return nil
+	}
 
-		ldFlags = append(ldFlags, "-linkmode external -extldflags \"-static\"")
+	return []string{"-tags", strings.Join(c.compilerTags, ",")}
+}
+
+func (c *compiler) execute(ctx context.Context, b build, cctx toolkit.CommandContext) (string, string, error) {
+	t, err := c.nt.render(b)
+
+	if err != nil {
+		return "", "", err
 	}
 
 	filename := filepath.Join(c.distDir, t)
 
-	err = c.executor.Exec(
-		ctx,
-		executil.Command{
-			Cmd: c.path,
-			Args: []string{
-				"build",
-				"-ldflags",
-				strings.Join(ldFlags, " "),
-				formattedTags,
-				"-o",
-				filename,
-				"./" + b.Path,
-			},
-
-			Stdout: cctx.CommandContext.Stdout,
-			Stderr: cctx.CommandContext.Stderr,
-			Env: map[string]string{
-				"GOOS":        b.OS,
-				"GOARCH":      b.Arch,
-				"CGO_ENABLED": cgoStr,
-			},
-		},
-	)
+	cmd := executil.Command{
+		Cmd:    c.path,
+		Args:   []string{"build", "-ldflags", c.ldFlags(b)},
+		Stdout: cctx.CommandContext.Stdout,
+		Stderr: cctx.CommandContext.Stderr,
+		Env:    c.env(b),
+	}
+
+	cmd.Args = append(append(cmd.Args, c.tagArgs()...), "-o", filename, "./"+b.Path)
+
+	cleanup, err := c.windows.writeSyso(b, filepath.Base(t))
 
 	if err != nil {
 		return "", "", err
 	}
 
-	f, err := os.Open(filename)
+	defer cleanup()
+
+	key, err := c.cacheKey(ctx, b, cmd)
 
 	if err != nil {
-		return "", "", errors.Wrapf(err, "cant open %q", filename)
+		return "", "", err
 	}
 
-	h := sha256.New()
-	_, err = io.Copy(h, f)
+	if sum, ok := c.cache.lookup(filename, t, key); ok && !c.force {
+		cctx.Logger.Noticef("Skipping %s, up to date (checksum: %s)", filename, sum)
+		c.report = append(c.report, buildReport{build: b, filename: t, skipped: true})
 
-	sum := hex.EncodeToString(h.Sum(nil))
+		return t, sum, nil
+	}
+
+	if err := c.executor.Exec(ctx, cmd); err != nil {
+		return "", "", err
+	}
+
+	if c.validateLinks {
+		if err := c.checkLinks(ctx, b, cmd.Env); err != nil {
+			return "", "", err
+		}
+	}
+
+	sum, err := hashFile(filename)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	c.cache.store(t, key, sum)
+	c.report = append(c.report, buildReport{build: b, filename: t})
 
 	cctx.Logger.Noticef(
 		"Finished compiling %s (checksum: %s)",
@@ -301,51 +472,229 @@ func (c *compiler) execute(ctx context.Context, b build, cctx toolkit.CommandCon
 		sum,
 	)
 
-	return t, sum, errors.Wrap(err, "cant hash the file")
+	return t, sum, nil
+}
+
+func hashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+
+	if err != nil {
+		return "", errors.Wrapf(err, "cant open %q", filename)
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrap(err, "cant hash the file")
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *compiler) compile(ctx context.Context, b build, cctx toolkit.CommandContext) (definitions.Artifact, error) {
+	fname, sum, err := c.execute(ctx, b, cctx)
+
+	if err != nil {
+		return definitions.Artifact{}, err
+	}
+
+	if e := c.cache.entries[fname]; e.Packed && e.Sizes != nil {
+		// the packed binary was verified, described and measured when built
+		c.sizes = append(c.sizes, sizeReport{build: b, filename: fname, sizes: *e.Sizes})
+
+		return c.artifact(b, definitions.Binary, fname, sum, c.sboms(fname))
+	}
+
+	if c.verifyBinaries {
+		if err := c.verify(ctx, b, fname, cctx); err != nil {
+			return definitions.Artifact{}, err
+		}
+	}
+
+	bi, err := c.buildInfo(fname)
+
+	if err != nil {
+		return definitions.Artifact{}, err
+	}
+
+	sizes, err := measure(filepath.Join(c.distDir, fname))
+
+	if err != nil {
+		return definitions.Artifact{}, err
+	}
+
+	if c.upx {
+		if sum, err = c.pack(ctx, b, fname, &sizes, cctx); err != nil {
+			return definitions.Artifact{}, err
+		}
+	}
+
+	sboms, err := c.writeSBOMs(b, fname, sum, bi)
+
+	if err != nil {
+		return definitions.Artifact{}, err
+	}
+
+	c.cache.update(fname, func(e *cacheEntry) {
+		e.Sha256 = sum
+		e.Packed = sizes.Packed
+		e.Sizes = &sizes
+	})
+
+	c.sizes = append(c.sizes, sizeReport{build: b, filename: fname, sizes: sizes})
+
+	return c.artifact(b, definitions.Binary, fname, sum, sboms)
 }
 
-type definition struct {
-	Filename string `json:"filename"`
-	Sha256   string `json:"sha256"`
+func (c *compiler) artifact(b build, k definitions.Kind, fname, sum string, sboms []definitions.SBOM) (definitions.Artifact, error) {
+	fi, err := os.Stat(filepath.Join(c.distDir, fname))
+
+	if err != nil {
+		return definitions.Artifact{}, err
+	}
+
+	return definitions.Artifact{
+		Name:      b.Name(),
+		Module:    b.Module.Path,
+		Version:   b.Version,
+		GoVersion: c.goVersion,
+		Kind:      k,
+		Path:      fname,
+		Size:      fi.Size(),
+		Checksums: definitions.Checksums{SHA256: sum},
+		OS:        b.OS,
+		Arch:      b.Arch,
+		SBOMs:     sboms,
+	}, nil
 }
 
 func main() {
 	toolkit.NewApp(
 		"compile-go",
 		func(ctx context.Context, cctx toolkit.CommandContext, c config) error {
-			bs, err := c.builds(cctx)
+			if c.GoVersion != "" {
+				p, err := c.pinGoToolchain(ctx, cctx)
+
+				if err != nil {
+					return err
+				}
+
+				c.CompilerPath = p
+			}
+
+			cp, err := newCompiler(c, cctx)
 
 			if err != nil {
 				return err
 			}
 
-			cp, err := newCompiler(c, cctx)
+			if cp.goVersion, err = cp.toolchainVersion(ctx); err != nil {
+				return err
+			}
+
+			exes, err := cp.executables(ctx, c, cctx)
+
+			if err != nil {
+				return err
+			}
+
+			bs, err := c.builds(cctx, exes)
+
+			if err != nil {
+				return err
+			}
+
+			if err := reportTargets(cctx, bs); err != nil {
+				return err
+			}
+
+			targets := bs
+
+			if c.UniversalBinaries {
+				targets = append(slices.Clip(bs), universalBuilds(bs)...)
+			}
+
+			if err := cp.nt.checkCollisions(targets); err != nil {
+				return err
+			}
+
+			docs, err := c.docsOptions()
+
+			if err != nil {
+				return err
+			}
+
+			ib, err := c.imageBuilder(cctx)
 
 			if err != nil {
 				return err
 			}
 
-			defs := make(map[string]map[string]definition)
+			if opts := c.gateOptions(); opts.enabled() {
+				if err := cp.gate(ctx, bs, opts, cctx); err != nil {
+					return err
+				}
+			}
+
+			var defs definitions.Definitions
 
 			for _, b := range bs {
-				fname, sha256Sum, err := cp.execute(ctx, b, cctx)
+				a, err := cp.compile(ctx, b, cctx)
 
 				if err != nil {
 					return err
 				}
-				n := b.Name()
 
-				if defs[n] == nil {
-					defs[n] = make(map[string]definition, 1)
+				defs.Artifacts = append(defs.Artifacts, a)
+			}
+
+			if c.UniversalBinaries {
+				for _, b := range universalBuilds(bs) {
+					a, ok, err := cp.universal(ctx, b, defs, cctx)
+
+					if err != nil {
+						return err
+					}
+
+					if ok {
+						defs.Artifacts = append(defs.Artifacts, a)
+					}
+				}
+			}
+
+			if docs.enabled() {
+				if defs.Documents, err = cp.generateDocs(ctx, bs, defs, docs, cctx); err != nil {
+					return err
 				}
+			}
 
-				defs[n][b.archKey()] = definition{
-					Filename: fname,
-					Sha256:   sha256Sum,
+			if ib != nil {
+				if defs.Images, err = ib.build(ctx, bs, defs, cctx); err != nil {
+					return err
 				}
 			}
 
-			buf, err := json.Marshal(defs)
+			if err := cp.cache.save(); err != nil {
+				return err
+			}
+
+			if err := cp.writeReport(cctx); err != nil {
+				return err
+			}
+
+			if err := cp.reportSizes(ctx, cctx, c.sizeBudget()); err != nil {
+				return err
+			}
+
+			var buf []byte
+
+			if c.DefinitionsFormat == definitions.Legacy {
+				buf, err = json.Marshal(defs.Legacy())
+			} else {
+				buf, err = defs.Marshal()
+			}
 
 			if err != nil {
 				return err
@@ -353,7 +702,17 @@ func main() {
 
 			cctx.Logger.Noticef("Binary definitions: %s", string(buf))
 
-			return cctx.Output.WriteKeyValue("definitions", string(buf))
+			if err := cctx.Output.WriteKeyValue("definitions", string(buf)); err != nil {
+				return err
+			}
+
+			buf, err = json.Marshal(moduleVersions(bs))
+
+			if err != nil {
+				return err
+			}
+
+			return cctx.Output.WriteKeyValue("versions", string(buf))
 		},
 		toolkit.WithDefaultConfig(defaultConfig),
 	).Run(context.Background())
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/upfluence/log/logtest"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/executil/executiltest"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+func outputPath(cmd executil.Command) string {
+	for i, arg := range cmd.Args {
+		if arg == "-o" && i+1 < len(cmd.Args) {
+			return cmd.Args[i+1]
+		}
+	}
+
+	return ""
+}
+
+func commandsOf(exc *executiltest.Executor, subcmd string) []executil.Command {
+	var cmds []executil.Command
+
+	for _, cmd := range exc.Commands() {
+		if len(cmd.Args) > 0 && cmd.Args[0] == subcmd {
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	return cmds
+}
+
+func invocationsOf(exc *executiltest.Executor, cmd string) []executil.Command {
+	var cmds []executil.Command
+
+	for _, c := range exc.Commands() {
+		if c.Cmd == cmd {
+			cmds = append(cmds, c)
+		}
+	}
+
+	return cmds
+}
+
+type execHandlers map[string]func(executil.Command) error
+
+func fakeExecutor() *executiltest.Executor {
+	return fakeExecutorWith(nil)
+}
+
+// fakeExecutorWith runs the handler keyed by the command or by its go
+// subcommand, other commands write their -o output if any.
+func fakeExecutorWith(hs execHandlers) *executiltest.Executor {
+	return &executiltest.Executor{
+		ExecFunc: func(_ context.Context, cmd executil.Command) error {
+			h, ok := hs[cmd.Cmd]
+
+			if !ok && len(cmd.Args) > 0 {
+				h, ok = hs[cmd.Args[0]]
+			}
+
+			if ok {
+				return h(cmd)
+			}
+
+			return writeOutput(cmd)
+		},
+	}
+}
+
+func writeOutput(cmd executil.Command) error {
+	if p := outputPath(cmd); p != "" {
+		return os.WriteFile(p, []byte("binary"), 0755)
+	}
+
+	return nil
+}
+
+func printOutput(v string) func(executil.Command) error {
+	return func(cmd executil.Command) error {
+		_, err := io.WriteString(cmd.Stdout, v)
+		return err
+	}
+}
+
+func testCommandContext(t testing.TB) toolkit.CommandContext {
+	return toolkit.CommandContext{
+		Logger:     logtest.WrapTestingLogger(t),
+		Sha:        "0123456789abcdef",
+		RefName:    "main",
+		Repository: "upfluence/foo",
+	}
+}
+
+func TestCompilerCGoEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		c    config
+
+		wantEnv    map[string]map[string]string
+		wantStatic map[string]bool
+	}{
+		{
+			name: "no cgo",
+			c:    config{OSs: []string{"linux"}, Archs: []string{"amd64"}},
+			wantEnv: map[string]map[string]string{
+				"linux/amd64": {
+					"GOOS":        "linux",
+					"GOARCH":      "amd64",
+					"CGO_ENABLED": "0",
+				},
+			},
+			wantStatic: map[string]bool{"linux/amd64": false},
+		},
+		{
+			name: "cross compilation",
+			c: config{
+				OSs:       []string{"linux"},
+				Archs:     []string{"amd64", "arm64"},
+				CGo:       true,
+				CC:        map[string]string{"linux/arm64": "aarch64-linux-gnu-gcc"},
+				CXX:       map[string]string{"linux/arm64": "aarch64-linux-gnu-g++"},
+				CGoCFlags: map[string]string{"*": "-O2"},
+			},
+			wantEnv: map[string]map[string]string{
+				"linux/amd64": {
+					"GOOS":        "linux",
+					"GOARCH":      "amd64",
+					"CGO_ENABLED": "1",
+					"CGO_CFLAGS":  "-O2",
+				},
+				"linux/arm64": {
+					"GOOS":        "linux",
+					"GOARCH":      "arm64",
+					"CGO_ENABLED": "1",
+					"CC":          "aarch64-linux-gnu-gcc",
+					"CXX":         "aarch64-linux-gnu-g++",
+					"CGO_CFLAGS":  "-O2",
+				},
+			},
+			wantStatic: map[string]bool{"linux/amd64": true, "linux/arm64": true},
+		},
+		{
+			name: "zig preset",
+			c: config{
+				OSs:                []string{"linux", "darwin"},
+				Archs:              []string{"arm64"},
+				CGo:                true,
+				CToolchains:        map[string]cToolchainPreset{"*": zigPreset},
+				CGoLDFlags:         map[string]string{"darwin/arm64": "-framework CoreFoundation"},
+				DynamicLinkTargets: []string{"darwin/arm64"},
+			},
+			wantEnv: map[string]map[string]string{
+				"linux/arm64": {
+					"GOOS":        "linux",
+					"GOARCH":      "arm64",
+					"CGO_ENABLED": "1",
+					"CC":          "zig cc -target aarch64-linux-musl",
+					"CXX":         "zig c++ -target aarch64-linux-musl",
+				},
+				"darwin/arm64": {
+					"GOOS":        "darwin",
+					"GOARCH":      "arm64",
+					"CGO_ENABLED": "1",
+					"CC":          "zig cc -target aarch64-macos",
+					"CXX":         "zig c++ -target aarch64-macos",
+					"CGO_LDFLAGS": "-framework CoreFoundation",
+				},
+			},
+			wantStatic: map[string]bool{"linux/arm64": true, "darwin/arm64": false},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				cctx = testCommandContext(t)
+				exc  = fakeExecutor()
+			)
+
+			tt.c.ExecutablePaths = []string{"."}
+			tt.c.DistDir = t.TempDir()
+			tt.c.CompilerPath = "go"
+			require.NoError(t, tt.c.NameTemplate.Parse("foo-{{ .OS }}-{{ .Arch }}"))
+
+			bs, err := tt.c.builds(cctx, []executable{{Path: "."}})
+			require.NoError(t, err)
+
+			cp, err := newCompiler(tt.c, cctx)
+			require.NoError(t, err)
+
+			cp.executor = exc
+
+			for _, b := range bs {
+				_, _, err := cp.execute(context.Background(), b, cctx)
+				require.NoError(t, err)
+			}
+
+			cmds := commandsOf(exc, "build")
+			require.Len(t, cmds, len(tt.wantEnv))
+
+			for _, cmd := range cmds {
+				k := cmd.Env["GOOS"] + "/" + cmd.Env["GOARCH"]
+
+				assert.Equal(t, tt.wantEnv[k], cmd.Env)
+				assert.Equal(
+					t,
+					tt.wantStatic[k],
+					strings.Contains(cmd.Args[2], `-extldflags "-static"`),
+				)
+			}
+		})
+	}
+}
+
+func TestCToolchainUnknownZigTarget(t *testing.T) {
+	_, err := config{
+		CToolchains: map[string]cToolchainPreset{"plan9/amd64": zigPreset},
+	}.cToolchain("plan9/amd64")
+
+	assert.Error(t, err)
+}
+
+type lineRecorder struct {
+	lines []string
+}
+
+func (lr *lineRecorder) WriteLine(l string) error {
+	lr.lines = append(lr.lines, l)
+	return nil
+}
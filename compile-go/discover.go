@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+var errNoExecutable = errors.New("executable-paths does not match any main package")
+
+type executable struct {
+	Path   string
+	Module goModule
+}
+
+func (c *compiler) listPackages(ctx context.Context, patterns []string) ([]listedPackage, error) {
+	var buf bytes.Buffer
+
+	if err := c.executor.Exec(
+		ctx,
+		executil.Command{
+			Cmd:    c.path,
+			Args:   append(append([]string{"list", "-e", "-json"}, c.tagArgs()...), patterns...),
+			Stdout: &buf,
+		},
+	); err != nil {
+		return nil, errors.Wrapf(err, "cant list packages %q", patterns)
+	}
+
+	var (
+		pkgs []listedPackage
+
+		dec = json.NewDecoder(&buf)
+	)
+
+	for dec.More() {
+		var pkg listedPackage
+
+		if err := dec.Decode(&pkg); err != nil {
+			return nil, errors.Wrap(err, "cant decode go list output")
+		}
+
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs, nil
+}
+
+func relativePath(wd, p string) string {
+	if rp, err := filepath.Rel(wd, p); err == nil {
+		return rp
+	}
+
+	return p
+}
+
+func isPattern(p string) bool {
+	return strings.Contains(p, "...")
+}
+
+func isExclusion(p string) bool {
+	return strings.HasPrefix(p, "!")
+}
+
+// excluded matches the slash separated path of a package against the
+// exclusion patterns, either globs (cmd/internal-*) or directory trees
+// (tools/...).
+func excluded(p string, excludes []string) bool {
+	p = filepath.ToSlash(p)
+
+	for _, ex := range excludes {
+		ex = path.Clean(strings.TrimPrefix(ex, "!"))
+
+		if prefix, ok := strings.CutSuffix(ex, "/..."); ok || ex == "..." {
+			if ex == "..." || p == prefix || strings.HasPrefix(p, prefix+"/") {
+				return true
+			}
+
+			continue
+		}
+
+		if ok, _ := path.Match(ex, p); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// executables resolves the executable paths into the main packages to
+// build. Globs are expanded on the file system, patterns holding "..." are
+// expanded by the go tool, across every module of the workspace if any, and
+// paths prefixed by ! exclude the packages they match. Every candidate goes
+// through go list so libraries are skipped and the module of every
+// executable is known, versions and links can be defined per module.
+func (c *compiler) executables(ctx context.Context, cfg config, cctx toolkit.CommandContext) ([]executable, error) {
+	gw, err := c.goWork(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		exes []executable
+
+		patterns, excludes, paths []string
+	)
+
+	for _, p := range cfg.ExecutablePaths {
+		switch {
+		case isExclusion(p):
+			excludes = append(excludes, p)
+		case isPattern(p):
+			patterns = append(patterns, p)
+		}
+	}
+
+	if gw == "" {
+		paths = patterns
+	} else {
+		ms, err := c.workspaceModules(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range patterns {
+			paths = append(paths, expandPattern(wd, p, ms)...)
+		}
+	}
+
+	ps, err := cfg.executablePaths()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range ps {
+		paths = append(paths, "./"+p)
+	}
+
+	if len(paths) == 0 {
+		return nil, errNoExecutable
+	}
+
+	pkgs, err := c.listPackages(ctx, paths)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range pkgs {
+		p := pkg.ImportPath
+
+		if pkg.Dir != "" {
+			p = relativePath(wd, pkg.Dir)
+		}
+
+		if pkg.Name != "main" {
+			// packages matched by a ... pattern are expected to include
+			// libraries, a glob matching one is worth a warning though
+			if !slices.ContainsFunc(pkg.Match, isPattern) {
+				cctx.Logger.Warningf("Skipping %s: %s", p, pkg.skipReason())
+			}
+
+			continue
+		}
+
+		if excluded(p, excludes) {
+			cctx.Logger.Infof("Skipping %s: excluded", p)
+			continue
+		}
+
+		exe := executable{Path: p}
+
+		if pkg.Module != nil {
+			exe.Module = goModule{Path: pkg.Module.Path, Dir: relativePath(wd, pkg.Module.Dir)}
+		}
+
+		exes = append(exes, exe)
+	}
+
+	if len(exes) == 0 {
+		return nil, errNoExecutable
+	}
+
+	return exes, nil
+}
+
+func (lp listedPackage) skipReason() string {
+	if lp.Error != nil {
+		return lp.Error.Err
+	}
+
+	return fmt.Sprintf("package %s is not a main package", lp.Name)
+}
+
+// reportTargets prints the resolved executables with their module, version
+// and targets before anything gets built.
+func reportTargets(cctx toolkit.CommandContext, bs []build) error {
+	var (
+		rows [][]string
+
+		targets = make(map[string][]string)
+	)
+
+	for _, b := range bs {
+		if _, ok := targets[b.Path]; !ok {
+			rows = append(rows, []string{b.Path, b.Module.Path, b.Version})
+		}
+
+		targets[b.Path] = append(targets[b.Path], b.archKey())
+	}
+
+	for i, row := range rows {
+		if row[1] == "" {
+			row[1] = "-"
+		}
+
+		rows[i] = append(row, strings.Join(targets[row[0]], ", "))
+	}
+
+	cctx.Logger.Noticef("Resolved %d executable(s), %d target(s)", len(rows), len(bs))
+
+	return writeTable(
+		cctx.StepSummary,
+		[]string{"Package", "Module", "Version", "Targets"},
+		rows,
+	)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+func chdir(t testing.TB, dir string) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestCompilerExecutables(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	for _, p := range []string{"cmd/foo", "cmd/internal-bar", "pkg/lib"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, p), 0755))
+	}
+
+	chdir(t, dir)
+
+	var (
+		cctx = testCommandContext(t)
+
+		exc = fakeExecutorWith(
+			execHandlers{
+				"list": func(cmd executil.Command) error {
+					var pkgs string
+
+					for _, arg := range cmd.Args[3:] {
+						name := "main"
+
+						if arg == "./pkg/lib" {
+							name = "lib"
+						}
+
+						pkgs += fmt.Sprintf(
+							`{"Name":%q,"Dir":%q,"Match":[%q],"Module":{"Path":"example.com/foo","Dir":%q}}`,
+							name,
+							filepath.Join(dir, arg),
+							arg,
+							dir,
+						)
+					}
+
+					_, err := fmt.Fprint(cmd.Stdout, pkgs)
+
+					return err
+				},
+			},
+		)
+
+		c = config{
+			ExecutablePaths: []string{"cmd/*", "pkg/*", "!cmd/internal-*"},
+			CompilerPath:    "go",
+		}
+	)
+
+	cp, err := newCompiler(c, cctx)
+	require.NoError(t, err)
+
+	cp.executor = exc
+
+	exes, err := cp.executables(context.Background(), c, cctx)
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]executable{{Path: "cmd/foo", Module: goModule{Path: "example.com/foo", Dir: "."}}},
+		exes,
+	)
+
+	assert.Equal(
+		t,
+		[]string{"list", "-e", "-json", "./cmd/foo", "./cmd/internal-bar", "./pkg/lib"},
+		commandsOf(exc, "list")[0].Args,
+	)
+
+	c.ExecutablePaths = []string{"pkg/*"}
+
+	_, err = cp.executables(context.Background(), c, cctx)
+	assert.Equal(t, errNoExecutable, err)
+}
+
+func TestExcluded(t *testing.T) {
+	for _, tt := range []struct {
+		path     string
+		excludes []string
+		want     bool
+	}{
+		{path: "cmd/internal-foo", excludes: []string{"!cmd/internal-*"}, want: true},
+		{path: "cmd/foo", excludes: []string{"!cmd/internal-*"}},
+		{path: "tools/gen/cmd", excludes: []string{"!./tools/..."}, want: true},
+		{path: "tools", excludes: []string{"!tools/..."}, want: true},
+		{path: "toolsbox/cmd", excludes: []string{"!tools/..."}},
+		{path: "cmd/foo", excludes: []string{"!..."}, want: true},
+	} {
+		assert.Equal(t, tt.want, excluded(tt.path, tt.excludes), tt.path)
+	}
+}
+
+func TestReportTargets(t *testing.T) {
+	var (
+		lr   lineRecorder
+		cctx = testCommandContext(t)
+	)
+
+	cctx.StepSummary = &lr
+
+	require.NoError(
+		t,
+		reportTargets(
+			cctx,
+			[]build{
+				{Path: "cmd/foo", Version: "v1.0.0", OS: "linux", Arch: "amd64"},
+				{Path: "cmd/foo", Version: "v1.0.0", OS: "darwin", Arch: "arm64"},
+				{
+					Path:    "tools/cmd/bar",
+					Module:  goModule{Path: "example.com/tools"},
+					Version: "v2.0.0",
+					OS:      "linux",
+					Arch:    "amd64",
+				},
+			},
+		),
+	)
+
+	assert.Equal(
+		t,
+		[]string{
+			"| Package | Module | Version | Targets |",
+			"| --- | --- | --- | --- |",
+			"| cmd/foo | - | v1.0.0 | linux/amd64, darwin/arm64 |",
+			"| tools/cmd/bar | example.com/tools | v2.0.0 | linux/amd64 |",
+			"",
+		},
+		lr.lines,
+	)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/definitions"
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+const (
+	defaultCompletionCommand = "{{ .Path }} completion {{ .Shell }}"
+	defaultManCommand        = "{{ .Path }} man"
+
+	completionsDir = "completions"
+	manDir         = "man"
+	manSection     = 1
+)
+
+type shell int
+
+const (
+	bash shell = iota
+	zsh
+	fish
+)
+
+func (s *shell) Parse(v string) error {
+	switch v {
+	case "bash":
+		*s = bash
+	case "zsh":
+		*s = zsh
+	case "fish":
+		*s = fish
+	default:
+		return fmt.Errorf("Invalid completion shell %q", v)
+	}
+
+	return nil
+}
+
+func (s shell) String() string {
+	switch s {
+	case zsh:
+		return "zsh"
+	case fish:
+		return "fish"
+	}
+
+	return "bash"
+}
+
+// filename follows the naming expected by each shell, and by the homebrew
+// bash_completion, zsh_completion and fish_completion helpers.
+func (s shell) filename(name string) string {
+	switch s {
+	case zsh:
+		return "_" + name
+	case fish:
+		return name + ".fish"
+	}
+
+	return name + ".bash"
+}
+
+type docsOptions struct {
+	shells     []shell
+	completion commandTemplate
+	man        bool
+	manCommand commandTemplate
+}
+
+func (c config) docsOptions() (docsOptions, error) {
+	opts := docsOptions{
+		shells:     c.Completions,
+		completion: c.CompletionCommand,
+		man:        c.ManPages,
+		manCommand: c.ManCommand,
+	}
+
+	for _, dc := range []struct {
+		ct *commandTemplate
+		v  string
+	}{
+		{ct: &opts.completion, v: defaultCompletionCommand},
+		{ct: &opts.manCommand, v: defaultManCommand},
+	} {
+		if dc.ct.t == nil {
+			if err := dc.ct.Parse(dc.v); err != nil {
+				return opts, err
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+func (o docsOptions) enabled() bool { return len(o.shells) > 0 || o.man }
+
+type docContext struct {
+	build
+
+	Path  string
+	Shell string
+}
+
+// generateDoc runs the rendered command against the binary and writes its
+// output at fname in the dist dir.
+func (c *compiler) generateDoc(ctx context.Context, ct commandTemplate, dc docContext, fname string) (definitions.Checksums, error) {
+	args, err := ct.render(dc)
+
+	if err != nil {
+		return definitions.Checksums{}, errors.Wrap(err, "cant render the command")
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	if err := c.executor.Exec(
+		ctx,
+		executil.Command{Cmd: args[0], Args: args[1:], Stdout: &stdout, Stderr: &stderr},
+	); err != nil {
+		return definitions.Checksums{}, errors.Wrapf(
+			err,
+			"%q failed: %s",
+			strings.Join(args, " "),
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	if stdout.Len() == 0 {
+		return definitions.Checksums{}, fmt.Errorf("%q printed nothing", strings.Join(args, " "))
+	}
+
+	target := filepath.Join(c.distDir, fname)
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return definitions.Checksums{}, err
+	}
+
+	if err := os.WriteFile(target, stdout.Bytes(), 0644); err != nil {
+		return definitions.Checksums{}, err
+	}
+
+	sum, err := hashFile(target)
+
+	return definitions.Checksums{SHA256: sum}, err
+}
+
+// generateDocs runs the completion and man page commands of every
+// executable against its native binary, the only one the runner can
+// execute. Executables without a native target are skipped.
+func (c *compiler) generateDocs(ctx context.Context, bs []build, defs definitions.Definitions, opts docsOptions, cctx toolkit.CommandContext) ([]definitions.Document, error) {
+	var (
+		docs  []definitions.Document
+		paths []string
+
+		natives = make(map[string]build)
+	)
+
+	for _, b := range bs {
+		if _, ok := natives[b.Path]; !ok && isNative(b) {
+			natives[b.Path] = b
+		}
+
+		if !slices.Contains(paths, b.Path) {
+			paths = append(paths, b.Path)
+		}
+	}
+
+	for _, p := range paths {
+		b, ok := natives[p]
+
+		if !ok {
+			cctx.Logger.Warningf("Skipping the completions and man pages of %s: no native binary", p)
+			continue
+		}
+
+		a, ok := defs.Lookup(b.Name(), b.archKey())
+
+		if !ok {
+			return nil, fmt.Errorf("no binary was built for %s (%s)", p, b.archKey())
+		}
+
+		bin, err := filepath.Abs(filepath.Join(c.distDir, a.Path))
+
+		if err != nil {
+			return nil, err
+		}
+
+		name := b.Name()
+
+		for _, s := range opts.shells {
+			fname := filepath.ToSlash(filepath.Join(completionsDir, s.filename(name)))
+
+			sums, err := c.generateDoc(ctx, opts.completion, docContext{build: b, Path: bin, Shell: s.String()}, fname)
+
+			if err != nil {
+				return nil, errors.Wrapf(err, "cant generate the %s completion of %s", s, name)
+			}
+
+			docs = append(
+				docs,
+				definitions.Document{
+					Name:      name,
+					Kind:      definitions.Completion,
+					Shell:     s.String(),
+					Path:      fname,
+					Checksums: sums,
+				},
+			)
+		}
+
+		if opts.man {
+			fname := fmt.Sprintf("%s/%s.%d", manDir, name, manSection)
+
+			sums, err := c.generateDoc(ctx, opts.manCommand, docContext{build: b, Path: bin}, fname)
+
+			if err != nil {
+				return nil, errors.Wrapf(err, "cant generate the man page of %s", name)
+			}
+
+			docs = append(
+				docs,
+				definitions.Document{
+					Name:      name,
+					Kind:      definitions.ManPage,
+					Section:   manSection,
+					Path:      fname,
+					Checksums: sums,
+				},
+			)
+		}
+
+		cctx.Logger.Noticef("Generated the completions and man pages of %s", name)
+	}
+
+	return docs, nil
+}
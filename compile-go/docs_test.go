@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/definitions"
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/executil/executiltest"
+)
+
+func TestGenerateDocs(t *testing.T) {
+	var (
+		dist = t.TempDir()
+		cctx = testCommandContext(t)
+
+		exc = &executiltest.Executor{
+			ExecFunc: func(_ context.Context, cmd executil.Command) error {
+				if cmd.Args[0] == "broken" {
+					return fmt.Errorf("exit status 2")
+				}
+
+				_, err := fmt.Fprintf(cmd.Stdout, "%s %s\n", filepath.Base(cmd.Cmd), strings.Join(cmd.Args, " "))
+				return err
+			},
+		}
+
+		cp = compiler{distDir: dist, executor: exc}
+
+		bs = []build{
+			{Path: "cmd/foo", OS: runtime.GOOS, Arch: runtime.GOARCH},
+			{Path: "cmd/foo", OS: "plan9", Arch: "386"},
+			{Path: "cmd/bar", OS: "plan9", Arch: "386"},
+		}
+
+		defs = definitions.Definitions{
+			Artifacts: []definitions.Artifact{
+				{Name: "foo", Path: "foo-native", OS: runtime.GOOS, Arch: runtime.GOARCH},
+				{Name: "foo", Path: "foo-plan9", OS: "plan9", Arch: "386"},
+				{Name: "bar", Path: "bar-plan9", OS: "plan9", Arch: "386"},
+			},
+		}
+
+		c = config{ManPages: true}
+	)
+
+	for _, v := range []string{"zsh", "fish"} {
+		var s shell
+
+		require.NoError(t, s.Parse(v))
+		c.Completions = append(c.Completions, s)
+	}
+
+	opts, err := c.docsOptions()
+	require.NoError(t, err)
+	assert.True(t, opts.enabled())
+
+	docs, err := cp.generateDocs(context.Background(), bs, defs, opts, cctx)
+	require.NoError(t, err)
+
+	require.Len(t, docs, 3)
+
+	assert.Equal(t, definitions.Completion, docs[0].Kind)
+	assert.Equal(t, "zsh", docs[0].Shell)
+	assert.Equal(t, "completions/_foo", docs[0].Path)
+	assert.Equal(t, "completions/foo.fish", docs[1].Path)
+	assert.Equal(t, definitions.ManPage, docs[2].Kind)
+	assert.Equal(t, "man/foo.1", docs[2].Path)
+
+	buf, err := os.ReadFile(filepath.Join(dist, "completions", "foo.fish"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo-native completion fish\n", string(buf))
+
+	buf, err = os.ReadFile(filepath.Join(dist, "man", "foo.1"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo-native man\n", string(buf))
+
+	sum, err := hashFile(filepath.Join(dist, "man", "foo.1"))
+	require.NoError(t, err)
+	assert.Equal(t, sum, docs[2].Checksums.SHA256)
+
+	require.NoError(t, opts.manCommand.Parse("{{ .Path }} broken"))
+
+	_, err = cp.generateDocs(context.Background(), bs, defs, opts, cctx)
+	assert.ErrorContains(t, err, "cant generate the man page of foo")
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+var (
+	vetLocationRegexp  = regexp.MustCompile(`^(?:vet: )?(.+\.go):(\d+)(?::\d+)?: (.*)$`)
+	testLocationRegexp = regexp.MustCompile(`^\s+(\S+\.go):(\d+): (.*)$`)
+)
+
+type gateOptions struct {
+	vet  bool
+	test bool
+	race bool
+}
+
+func (c config) gateOptions() gateOptions {
+	return gateOptions{vet: c.Vet, test: c.Test, race: c.Race}
+}
+
+func (g gateOptions) enabled() bool { return g.vet || g.test }
+
+type issue struct {
+	file  string
+	line  int
+	title string
+	msg   string
+}
+
+func (i issue) log(cctx toolkit.CommandContext) {
+	l := cctx.Logger.WithField(toolkit.Title(i.title))
+
+	if i.file != "" {
+		l = l.WithFields(toolkit.File(i.file), toolkit.Line(i.line))
+	}
+
+	l.Error(i.msg)
+}
+
+func parseVetOutput(r io.Reader) []issue {
+	var (
+		issues []issue
+
+		s = bufio.NewScanner(r)
+	)
+
+	for s.Scan() {
+		m := vetLocationRegexp.FindStringSubmatch(s.Text())
+
+		if m == nil {
+			continue
+		}
+
+		line, _ := strconv.Atoi(m[2])
+
+		issues = append(
+			issues,
+			issue{file: filepath.Clean(m[1]), line: line, title: "go vet", msg: m[3]},
+		)
+	}
+
+	return issues
+}
+
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+type testResult struct {
+	pkg string
+
+	passed  int
+	failed  int
+	skipped int
+	elapsed float64
+
+	// failures holds the output of every failing test, by test name
+	failures map[string][]string
+	order    []string
+}
+
+func parseTestEvents(r io.Reader) ([]*testResult, error) {
+	var (
+		results []*testResult
+
+		byPkg   = make(map[string]*testResult)
+		outputs = make(map[string][]string)
+		dec     = json.NewDecoder(r)
+	)
+
+	for dec.More() {
+		var e testEvent
+
+		if err := dec.Decode(&e); err != nil {
+			return nil, errors.Wrap(err, "cant decode go test output")
+		}
+
+		if e.Package == "" {
+			continue
+		}
+
+		tr, ok := byPkg[e.Package]
+
+		if !ok {
+			tr = &testResult{pkg: e.Package, failures: make(map[string][]string)}
+			byPkg[e.Package] = tr
+			results = append(results, tr)
+		}
+
+		key := e.Package + "." + e.Test
+
+		switch e.Action {
+		case "output":
+			if e.Test != "" {
+				outputs[key] = append(outputs[key], strings.TrimRight(e.Output, "\n"))
+			}
+		case "pass", "fail", "skip":
+			if e.Test == "" {
+				tr.elapsed = e.Elapsed
+
+				if e.Action == "fail" && tr.failed == 0 {
+					// the package failed without any failing test, i.e. it
+					// does not build or panicked in an init function
+					tr.failed++
+				}
+
+				continue
+			}
+
+			switch e.Action {
+			case "pass":
+				tr.passed++
+			case "skip":
+				tr.skipped++
+			case "fail":
+				tr.failed++
+				tr.failures[e.Test] = outputs[key]
+				tr.order = append(tr.order, e.Test)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func (tr *testResult) issues(dir string) []issue {
+	var issues []issue
+
+	for _, name := range tr.order {
+		i := issue{title: name, msg: strings.Join(tr.failures[name], "\n")}
+
+		for _, l := range tr.failures[name] {
+			if m := testLocationRegexp.FindStringSubmatch(l); m != nil {
+				i.file = filepath.Join(dir, m[1])
+				i.line, _ = strconv.Atoi(m[2])
+				i.msg = strings.TrimSpace(m[3])
+
+				break
+			}
+		}
+
+		issues = append(issues, i)
+	}
+
+	return issues
+}
+
+func (c *compiler) gatePackages(ctx context.Context, bs []build) ([]listedPackage, error) {
+	var (
+		pkgs []listedPackage
+
+		seen = make(map[string]struct{})
+	)
+
+	for _, b := range bs {
+		if _, ok := seen["./"+b.Path]; ok {
+			continue
+		}
+
+		seen["./"+b.Path] = struct{}{}
+
+		deps, err := c.listDeps(ctx, build{Path: b.Path}, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pkg := range deps {
+			if _, ok := seen[pkg.ImportPath]; ok || pkg.Module == nil || !pkg.Module.Main {
+				continue
+			}
+
+			seen[pkg.ImportPath] = struct{}{}
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	return pkgs, nil
+}
+
+func (c *compiler) run(ctx context.Context, env map[string]string, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	err := c.executor.Exec(
+		ctx,
+		executil.Command{Cmd: c.path, Args: args, Env: env, Stdout: &stdout, Stderr: &stderr},
+	)
+
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// gate vets and tests the packages compiled in the executables before any
+// build happens.
+func (c *compiler) gate(ctx context.Context, bs []build, opts gateOptions, cctx toolkit.CommandContext) error {
+	pkgs, err := c.gatePackages(ctx, bs)
+
+	if err != nil {
+		return err
+	}
+
+	if len(pkgs) == 0 {
+		return nil
+	}
+
+	var (
+		failed bool
+
+		importPaths []string
+		dirs        = make(map[string]string, len(pkgs))
+	)
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		importPaths = append(importPaths, pkg.ImportPath)
+
+		if dir, err := filepath.Rel(wd, pkg.Dir); err == nil {
+			dirs[pkg.ImportPath] = dir
+		}
+	}
+
+	if opts.vet {
+		_, stderr, err := c.run(ctx, nil, append(append([]string{"vet"}, c.tagArgs()...), importPaths...)...)
+
+		issues := parseVetOutput(bytes.NewReader(stderr))
+
+		for _, i := range issues {
+			i.log(cctx)
+		}
+
+		if err != nil {
+			failed = true
+
+			if len(issues) == 0 {
+				cctx.Logger.WithField(toolkit.Title("go vet")).Error(string(stderr))
+			}
+		}
+	}
+
+	if opts.test {
+		var (
+			env  map[string]string
+			args = append([]string{"test", "-json"}, c.tagArgs()...)
+		)
+
+		if opts.race {
+			env = map[string]string{"CGO_ENABLED": "1"}
+			args = append(args, "-race")
+		}
+
+		stdout, stderr, err := c.run(ctx, env, append(args, importPaths...)...)
+
+		results, perr := parseTestEvents(bytes.NewReader(stdout))
+
+		if perr != nil {
+			return perr
+		}
+
+		var rows [][]string
+
+		for _, tr := range results {
+			for _, i := range tr.issues(dirs[tr.pkg]) {
+				i.log(cctx)
+			}
+
+			status := "ok"
+
+			if tr.failed > 0 {
+				status = "FAIL"
+			}
+
+			rows = append(
+				rows,
+				[]string{
+					tr.pkg,
+					status,
+					strconv.Itoa(tr.passed),
+					strconv.Itoa(tr.failed),
+					strconv.Itoa(tr.skipped),
+					fmt.Sprintf("%.2fs", tr.elapsed),
+				},
+			)
+		}
+
+		if err := writeTable(
+			cctx.StepSummary,
+			[]string{"Package", "Status", "Passed", "Failed", "Skipped", "Duration"},
+			rows,
+		); err != nil {
+			return err
+		}
+
+		if err != nil {
+			failed = true
+
+			if len(results) == 0 {
+				cctx.Logger.WithField(toolkit.Title("go test")).Error(string(stderr))
+			}
+		}
+	}
+
+	if failed {
+		return errors.New("go vet or go test failed, aborting the build")
+	}
+
+	return nil
+}
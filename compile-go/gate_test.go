@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+const testEvents = `{"Action":"start","Package":"example.com/foo"}
+{"Action":"run","Package":"example.com/foo","Test":"TestOK"}
+{"Action":"output","Package":"example.com/foo","Test":"TestOK","Output":"=== RUN   TestOK\n"}
+{"Action":"pass","Package":"example.com/foo","Test":"TestOK","Elapsed":0.01}
+{"Action":"run","Package":"example.com/foo","Test":"TestKO"}
+{"Action":"output","Package":"example.com/foo","Test":"TestKO","Output":"=== RUN   TestKO\n"}
+{"Action":"output","Package":"example.com/foo","Test":"TestKO","Output":"    foo_test.go:12: want 1, got 2\n"}
+{"Action":"fail","Package":"example.com/foo","Test":"TestKO","Elapsed":0.02}
+{"Action":"skip","Package":"example.com/foo","Test":"TestSkipped","Elapsed":0}
+{"Action":"fail","Package":"example.com/foo","Elapsed":0.5}
+{"Action":"pass","Package":"example.com/bar","Elapsed":0.1}
+`
+
+func TestParseTestEvents(t *testing.T) {
+	results, err := parseTestEvents(strings.NewReader(testEvents))
+	require.NoError(t, err)
+
+	require.Len(t, results, 2)
+
+	foo := results[0]
+
+	assert.Equal(t, "example.com/foo", foo.pkg)
+	assert.Equal(t, 1, foo.passed)
+	assert.Equal(t, 1, foo.failed)
+	assert.Equal(t, 1, foo.skipped)
+	assert.Equal(t, 0.5, foo.elapsed)
+
+	assert.Equal(
+		t,
+		[]issue{{file: "pkg/foo/foo_test.go", line: 12, title: "TestKO", msg: "want 1, got 2"}},
+		foo.issues("pkg/foo"),
+	)
+
+	assert.Equal(t, &testResult{pkg: "example.com/bar", elapsed: 0.1, failures: map[string][]string{}}, results[1])
+}
+
+func TestParseVetOutput(t *testing.T) {
+	assert.Equal(
+		t,
+		[]issue{
+			{file: "pkg/foo/foo.go", line: 3, title: "go vet", msg: "fmt.Sprintf format %d has arg x of wrong type string"},
+			{file: "pkg/bar/bar.go", line: 8, title: "go vet", msg: "unreachable code"},
+		},
+		parseVetOutput(
+			strings.NewReader(
+				`# example.com/foo
+./pkg/foo/foo.go:3:2: fmt.Sprintf format %d has arg x of wrong type string
+# example.com/bar
+vet: pkg/bar/bar.go:8: unreachable code
+`,
+			),
+		),
+	)
+}
+
+func TestGate(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name string
+		opts gateOptions
+
+		vetErr  error
+		testErr error
+
+		wantArgs [][]string
+		wantErr  bool
+	}{
+		{
+			name: "success",
+			opts: gateOptions{vet: true, test: true, race: true},
+			wantArgs: [][]string{
+				{"list", "-deps", "-json", "./cmd/foo"},
+				{"vet", "example.com/foo/pkg/foo", "example.com/foo/cmd/foo"},
+				{"test", "-json", "-race", "example.com/foo/pkg/foo", "example.com/foo/cmd/foo"},
+			},
+		},
+		{
+			name:    "vet failure",
+			opts:    gateOptions{vet: true},
+			vetErr:  errors.New("exit status 1"),
+			wantErr: true,
+			wantArgs: [][]string{
+				{"list", "-deps", "-json", "./cmd/foo"},
+				{"vet", "example.com/foo/pkg/foo", "example.com/foo/cmd/foo"},
+			},
+		},
+		{
+			name:    "test failure",
+			opts:    gateOptions{test: true},
+			testErr: errors.New("exit status 1"),
+			wantErr: true,
+			wantArgs: [][]string{
+				{"list", "-deps", "-json", "./cmd/foo"},
+				{"test", "-json", "example.com/foo/pkg/foo", "example.com/foo/cmd/foo"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exc := fakeExecutorWith(
+				execHandlers{
+					"list": printOutput(
+						`{"ImportPath":"fmt","Standard":true}
+{"ImportPath":"github.com/foo/bar","Module":{"Path":"github.com/foo/bar","Version":"v1.0.0"}}
+{"ImportPath":"example.com/foo/pkg/foo","Dir":"` + filepath.Join(wd, "pkg/foo") + `","Module":{"Path":"example.com/foo","Main":true}}
+{"ImportPath":"example.com/foo/cmd/foo","Dir":"` + filepath.Join(wd, "cmd/foo") + `","Module":{"Path":"example.com/foo","Main":true}}`,
+					),
+					"vet": func(cmd executil.Command) error {
+						io.WriteString(cmd.Stderr, "./pkg/foo/foo.go:3:2: unreachable code\n")
+						return tt.vetErr
+					},
+					"test": func(cmd executil.Command) error {
+						io.WriteString(cmd.Stdout, testEvents)
+						return tt.testErr
+					},
+				},
+			)
+
+			cctx := testCommandContext(t)
+			cctx.StepSummary = &lineRecorder{}
+
+			cp := compiler{path: "go", executor: exc}
+
+			err := cp.gate(
+				context.Background(),
+				[]build{{Path: "cmd/foo", OS: "linux"}, {Path: "cmd/foo", OS: "darwin"}},
+				tt.opts,
+				cctx,
+			)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			var args [][]string
+
+			for _, cmd := range exc.Commands() {
+				args = append(args, cmd.Args)
+			}
+
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
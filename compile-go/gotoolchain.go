@@ -0,0 +1,501 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+const (
+	defaultGoMirror = "https://dl.google.com/go/"
+
+	// marker written once a toolchain is fully unpacked, as golang.org/dl does
+	unpackedMarker = ".unpacked-success"
+)
+
+// goVersion is a go release as understood by the toolchain directive:
+// 1.21 (language version), 1.21rc1 and 1.21.0.
+type goVersion struct {
+	major, minor, patch int
+	kind                string
+	pre                 int
+}
+
+var goVersionKinds = map[string]int{"": 0, "alpha": 1, "beta": 2, "rc": 3}
+
+func parseGoVersion(v string) (goVersion, error) {
+	var (
+		gv goVersion
+
+		s = strings.TrimPrefix(v, "go")
+	)
+
+	for _, kind := range []string{"alpha", "beta", "rc"} {
+		if i := strings.Index(s, kind); i > 0 {
+			pre, err := strconv.Atoi(s[i+len(kind):])
+
+			if err != nil {
+				return gv, fmt.Errorf("invalid go version %q", v)
+			}
+
+			gv.kind, gv.pre, s = kind, pre, s[:i]
+			break
+		}
+	}
+
+	ps := strings.Split(s, ".")
+
+	if len(ps) < 2 || len(ps) > 3 || (len(ps) == 3 && gv.kind != "") {
+		return gv, fmt.Errorf("invalid go version %q", v)
+	}
+
+	gv.patch = -1
+
+	fields := []*int{&gv.major, &gv.minor, &gv.patch}
+
+	for i, p := range ps {
+		n, err := strconv.Atoi(p)
+
+		if err != nil {
+			return gv, fmt.Errorf("invalid go version %q", v)
+		}
+
+		*fields[i] = n
+	}
+
+	return gv, nil
+}
+
+func (gv goVersion) String() string {
+	s := fmt.Sprintf("go%d.%d", gv.major, gv.minor)
+
+	switch {
+	case gv.kind != "":
+		s += fmt.Sprintf("%s%d", gv.kind, gv.pre)
+	case gv.patch >= 0:
+		s += fmt.Sprintf(".%d", gv.patch)
+	}
+
+	return s
+}
+
+func (gv goVersion) compare(ogv goVersion) int {
+	for _, d := range [][2]int{
+		{gv.major, ogv.major},
+		{gv.minor, ogv.minor},
+		{gv.patch, ogv.patch},
+		{goVersionKinds[gv.kind], goVersionKinds[ogv.kind]},
+		{gv.pre, ogv.pre},
+	} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return 0
+}
+
+type goModDirectives struct {
+	goVersion string
+	toolchain string
+}
+
+func readGoModDirectives(fname string) (goModDirectives, error) {
+	var gmd goModDirectives
+
+	f, err := os.Open(fname)
+
+	if err != nil {
+		return gmd, err
+	}
+
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+
+	for s.Scan() {
+		fs := strings.Fields(s.Text())
+
+		if len(fs) != 2 {
+			continue
+		}
+
+		switch fs[0] {
+		case "go":
+			gmd.goVersion = fs[1]
+		case "toolchain":
+			gmd.toolchain = fs[1]
+		}
+	}
+
+	return gmd, s.Err()
+}
+
+// checkGoMod makes sure the pinned version satisfies the go directive of
+// go.mod, and warns when it is older than the suggested toolchain.
+func checkGoMod(gv goVersion, fname string, cctx toolkit.CommandContext) error {
+	gmd, err := readGoModDirectives(fname)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "cant read %q", fname)
+	}
+
+	if gmd.goVersion != "" {
+		min, err := parseGoVersion(gmd.goVersion)
+
+		if err != nil {
+			return errors.Wrapf(err, "invalid go directive in %q", fname)
+		}
+
+		if gv.compare(min) < 0 {
+			return fmt.Errorf("go-version %s is older than the go %s directive of %q", gv, gmd.goVersion, fname)
+		}
+	}
+
+	if gmd.toolchain != "" {
+		tc, err := parseGoVersion(gmd.toolchain)
+
+		if err != nil {
+			return errors.Wrapf(err, "invalid toolchain directive in %q", fname)
+		}
+
+		if gv.compare(tc) < 0 {
+			cctx.Logger.Warningf("go-version %s is older than the toolchain %s directive of %q", gv, gmd.toolchain, fname)
+		}
+	}
+
+	return nil
+}
+
+type goToolchain struct {
+	dir    string
+	mirror string
+	client *http.Client
+
+	goos, goarch string
+}
+
+func (c config) goToolchain() (goToolchain, error) {
+	gt := goToolchain{
+		dir:    c.GoToolchainDir,
+		mirror: c.GoMirror,
+		goos:   runtime.GOOS,
+		goarch: runtime.GOARCH,
+	}
+
+	if gt.dir == "" {
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+			return gt, errors.Wrap(err, "cant locate the toolchain cache dir")
+		}
+
+		gt.dir = filepath.Join(home, "sdk")
+	}
+
+	if gt.mirror == "" {
+		gt.mirror = defaultGoMirror
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+
+	gt.client = &http.Client{Transport: t}
+
+	return gt, nil
+}
+
+func (gt goToolchain) archive(gv goVersion) string {
+	ext := ".tar.gz"
+
+	if gt.goos == "windows" {
+		ext = ".zip"
+	}
+
+	return fmt.Sprintf("%s.%s-%s%s", gv, gt.goos, gt.goarch, ext)
+}
+
+func (gt goToolchain) binary(root string) string {
+	bin := filepath.Join(root, "bin", "go")
+
+	if gt.goos == "windows" {
+		bin += ".exe"
+	}
+
+	return bin
+}
+
+func (gt goToolchain) fetch(ctx context.Context, url string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	resp, err := gt.client.Do(req)
+
+	if err != nil {
+		return errors.Wrapf(err, "cant fetch %q", url)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cant fetch %q: %s", url, resp.Status)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+
+	return err
+}
+
+// resolve returns the go binary of the requested version, downloading and
+// unpacking it in the cache dir when missing.
+func (gt goToolchain) resolve(ctx context.Context, gv goVersion, cctx toolkit.CommandContext) (string, error) {
+	root := filepath.Join(gt.dir, gv.String())
+
+	if _, err := os.Stat(filepath.Join(root, unpackedMarker)); err == nil {
+		cctx.Logger.Infof("Using cached toolchain %s", root)
+		return gt.binary(root), nil
+	}
+
+	var (
+		archive = gt.archive(gv)
+		url     = strings.TrimSuffix(gt.mirror, "/") + "/" + archive
+
+		sum strings.Builder
+	)
+
+	if err := gt.fetch(ctx, url+".sha256", &sum); err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp("", "go-toolchain-*")
+
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+
+	cctx.Logger.Noticef("Downloading %s", url)
+
+	if err := gt.fetch(ctx, url, io.MultiWriter(f, h)); err != nil {
+		return "", err
+	}
+
+	// the digest may be followed by the file name, as sha256sum outputs it
+	want, _, _ := strings.Cut(strings.TrimSpace(sum.String()), " ")
+
+	if got := hex.EncodeToString(h.Sum(nil)); want != got {
+		return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", archive, want, got)
+	}
+
+	if err := os.RemoveAll(root); err != nil {
+		return "", err
+	}
+
+	if strings.HasSuffix(archive, ".zip") {
+		err = unpackZip(f, root)
+	} else {
+		_, err = f.Seek(0, io.SeekStart)
+
+		if err == nil {
+			err = unpackTarGz(f, root)
+		}
+	}
+
+	if err != nil {
+		return "", errors.Wrapf(err, "cant unpack %s", archive)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, unpackedMarker), nil, 0644); err != nil {
+		return "", err
+	}
+
+	return gt.binary(root), nil
+}
+
+// archiveTarget maps a member of the archive, prefixed by go/, into root.
+func archiveTarget(root, name string) (string, bool) {
+	name, ok := strings.CutPrefix(filepath.ToSlash(name), "go/")
+
+	if !ok || name == "" {
+		return "", false
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(name))
+
+	return target, isWithin(root, target)
+}
+
+func writeArchiveFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func unpackTarGz(r io.Reader, root string) error {
+	gr, err := gzip.NewReader(r)
+
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gr)
+
+	for {
+		h, err := tr.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		target, ok := archiveTarget(root, h.Name)
+
+		if !ok {
+			continue
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = writeArchiveFile(target, tr, h.FileInfo().Mode().Perm())
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func unpackZip(f *os.File, root string) error {
+	fi, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(f, fi.Size())
+
+	if err != nil {
+		return err
+	}
+
+	for _, zf := range zr.File {
+		target, ok := archiveTarget(root, zf.Name)
+
+		if !ok || zf.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := zf.Open()
+
+		if err != nil {
+			return err
+		}
+
+		err = writeArchiveFile(target, rc, zf.Mode().Perm())
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pinGoToolchain resolves the go binary of go-version after checking it
+// against go.mod. GOTOOLCHAIN is forced to local so the go command does not
+// switch to another toolchain behind our back.
+func (c config) pinGoToolchain(ctx context.Context, cctx toolkit.CommandContext) (string, error) {
+	if c.CompilerPath != "" {
+		return "", errors.New("compiler-path and go-version are mutually exclusive")
+	}
+
+	gv, err := parseGoVersion(c.GoVersion)
+
+	if err != nil {
+		return "", err
+	}
+
+	if gv.patch < 0 && gv.kind == "" {
+		return "", fmt.Errorf("go-version %q is a language version, a release is expected (i.e. %s.0)", c.GoVersion, gv)
+	}
+
+	for _, fname := range []string{"go.mod", "go.work"} {
+		if err := checkGoMod(gv, fname, cctx); err != nil {
+			return "", err
+		}
+	}
+
+	gt, err := c.goToolchain()
+
+	if err != nil {
+		return "", err
+	}
+
+	p, err := gt.resolve(ctx, gv, cctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	return p, os.Setenv("GOTOOLCHAIN", "local")
+}
+
+func (c *compiler) toolchainVersion(ctx context.Context) (string, error) {
+	out, err := c.output(ctx, nil, "env", "GOVERSION")
+
+	if err != nil {
+		return "", errors.Wrap(err, "cant read the go version")
+	}
+
+	return strings.TrimSpace(out), nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoVersionCompare(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.21", b: "1.21rc1", want: -1},
+		{a: "1.21rc1", b: "1.21rc2", want: -1},
+		{a: "go1.21rc2", b: "1.21.0", want: -1},
+		{a: "1.21.0", b: "go1.21.0", want: 0},
+		{a: "1.22.1", b: "1.21.10", want: 1},
+		{a: "1.21beta1", b: "1.21rc1", want: -1},
+	} {
+		a, err := parseGoVersion(tt.a)
+		require.NoError(t, err)
+
+		b, err := parseGoVersion(tt.b)
+		require.NoError(t, err)
+
+		assert.Equal(t, tt.want, a.compare(b), "%s <> %s", tt.a, tt.b)
+	}
+
+	for _, v := range []string{"1", "1.x", "1.21.0rc1", "1.21.1.1", "1.21rcx"} {
+		_, err := parseGoVersion(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestCheckGoMod(t *testing.T) {
+	var (
+		cctx  = testCommandContext(t)
+		fname = filepath.Join(t.TempDir(), "go.mod")
+	)
+
+	require.NoError(
+		t,
+		os.WriteFile(fname, []byte("module foo\n\ngo 1.23.0\n\ntoolchain go1.24.0\n"), 0644),
+	)
+
+	for _, tt := range []struct {
+		version string
+		wantErr bool
+	}{
+		{version: "1.22.5", wantErr: true},
+		{version: "1.23.0"},
+		{version: "1.25.1"},
+	} {
+		gv, err := parseGoVersion(tt.version)
+		require.NoError(t, err)
+
+		err = checkGoMod(gv, fname, cctx)
+
+		if tt.wantErr {
+			assert.Error(t, err, tt.version)
+		} else {
+			assert.NoError(t, err, tt.version)
+		}
+	}
+
+	gv, _ := parseGoVersion("1.0.0")
+	assert.NoError(t, checkGoMod(gv, filepath.Join(t.TempDir(), "go.mod"), cctx))
+}
+
+func writeGoArchive(t testing.TB, dir, name string) {
+	var buf bytes.Buffer
+
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for _, f := range []struct {
+		name string
+		mode int64
+		body string
+	}{
+		{name: "go/VERSION", mode: 0644, body: "go1.25.1\n"},
+		{name: "go/bin/go", mode: 0755, body: "#!/bin/sh\necho go1.25.1\n"},
+		{name: "../escape", mode: 0644, body: "nope"},
+	} {
+		require.NoError(
+			t,
+			tw.WriteHeader(
+				&tar.Header{Name: f.name, Mode: f.mode, Size: int64(len(f.body)), Typeflag: tar.TypeReg},
+			),
+		)
+
+		_, err := tw.Write([]byte(f.body))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+
+	sum := sha256.Sum256(buf.Bytes())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644))
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, name+".sha256"), []byte(hex.EncodeToString(sum[:])), 0644),
+	)
+}
+
+func TestGoToolchainResolve(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		cctx   = testCommandContext(t)
+		mirror = t.TempDir()
+		cache  = t.TempDir()
+	)
+
+	gt, err := config{GoToolchainDir: cache, GoMirror: "file://" + mirror}.goToolchain()
+	require.NoError(t, err)
+
+	gt.goos, gt.goarch = "linux", "amd64"
+
+	gv, err := parseGoVersion("1.25.1")
+	require.NoError(t, err)
+
+	writeGoArchive(t, mirror, "go1.25.1.linux-amd64.tar.gz")
+
+	p, err := gt.resolve(ctx, gv, cctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(cache, "go1.25.1", "bin", "go"), p)
+
+	fi, err := os.Stat(p)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), fi.Mode().Perm())
+
+	_, err = os.Stat(filepath.Join(cache, "escape"))
+	assert.True(t, os.IsNotExist(err))
+
+	// the toolchain is now served from the cache
+	require.NoError(t, os.Remove(filepath.Join(mirror, "go1.25.1.linux-amd64.tar.gz")))
+
+	p, err = gt.resolve(ctx, gv, cctx)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cache, "go1.25.1", "bin", "go"), p)
+}
+
+func TestGoToolchainResolveChecksumMismatch(t *testing.T) {
+	var (
+		cctx   = testCommandContext(t)
+		mirror = t.TempDir()
+	)
+
+	gt, err := config{GoToolchainDir: t.TempDir(), GoMirror: "file://" + mirror}.goToolchain()
+	require.NoError(t, err)
+
+	gt.goos, gt.goarch = "linux", "arm64"
+
+	writeGoArchive(t, mirror, "go1.25.1.linux-arm64.tar.gz")
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(mirror, "go1.25.1.linux-arm64.tar.gz.sha256"), []byte("deadbeef"), 0644),
+	)
+
+	gv, _ := parseGoVersion("1.25.1")
+
+	_, err = gt.resolve(context.Background(), gv, cctx)
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestPinGoToolchainLanguageVersion(t *testing.T) {
+	_, err := config{GoVersion: "1.25"}.pinGoToolchain(context.Background(), testCommandContext(t))
+	assert.Error(t, err)
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/definitions"
+	"github.com/upfluence/actions/pkg/oci"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+const (
+	imageBinaryDir = "/usr/local/bin"
+	scratchImage   = "scratch"
+)
+
+type imageBuilder struct {
+	name nameTemplate
+
+	base    *oci.Layout
+	baseRef string
+
+	tags   []string
+	labels map[string]string
+
+	push       bool
+	client     *oci.Client
+	credential *oci.Credential
+
+	distDir string
+	created time.Time
+}
+
+// imageBuilder returns nil unless image-name is set. image-base is either
+// scratch or the path of an OCI layout, optionally followed by :ref to pick
+// one of its manifests.
+func (c config) imageBuilder(cctx toolkit.CommandContext) (*imageBuilder, error) {
+	if c.ImageName.t == nil {
+		return nil, nil
+	}
+
+	ib := imageBuilder{
+		name:    c.ImageName,
+		tags:    c.ImageTags,
+		push:    c.ImagePush,
+		distDir: c.DistDir,
+		created: time.Now().UTC(),
+		labels: map[string]string{
+			oci.AnnotationSource:   "https://github.com/" + cctx.Repository,
+			oci.AnnotationRevision: cctx.Sha,
+		},
+	}
+
+	maps.Copy(ib.labels, c.ImageLabels)
+
+	if c.SourceDateEpoch > 0 {
+		ib.created = time.Unix(c.SourceDateEpoch, 0).UTC()
+	}
+
+	for _, t := range ib.tags {
+		if err := oci.ValidateTag(t); err != nil {
+			return nil, errors.Wrap(err, "invalid image-tags")
+		}
+	}
+
+	if base := c.ImageBase; base != "" && base != scratchImage {
+		dir, ref := base, ""
+
+		if i := strings.LastIndex(base, ":"); i > 0 {
+			dir, ref = base[:i], base[i+1:]
+		}
+
+		l, err := oci.ReadLayout(dir)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid image-base")
+		}
+
+		ib.base, ib.baseRef = l, ref
+	}
+
+	if ib.push {
+		ib.client = &oci.Client{Credentials: make(map[string]oci.Credential)}
+
+		if c.ImageRegistryUsername != "" {
+			ib.credential = &oci.Credential{
+				Username: c.ImageRegistryUsername,
+				Password: c.ImageRegistryPassword,
+			}
+		}
+	}
+
+	return &ib, nil
+}
+
+func (ib *imageBuilder) reference(b build) (oci.Reference, error) {
+	name, err := ib.name.render(b)
+
+	if err != nil {
+		return oci.Reference{}, errors.Wrap(err, "cant render image-name")
+	}
+
+	r, err := oci.ParseReference(name)
+
+	if err != nil {
+		return r, errors.Wrap(err, "invalid image-name")
+	}
+
+	if r.Tag != "" {
+		return r, fmt.Errorf("image-name %q holds a tag, use image-tags instead", name)
+	}
+
+	return r, nil
+}
+
+// imageTags defaults to the version of the executable, build metadata is
+// not allowed in tags so + is replaced by _ as docker does.
+func (ib *imageBuilder) imageTags(b build) []string {
+	if len(ib.tags) > 0 {
+		return ib.tags
+	}
+
+	if b.Version == "" {
+		return []string{"latest"}
+	}
+
+	return []string{strings.ReplaceAll(b.Version, "+", "_")}
+}
+
+func (ib *imageBuilder) image(b build, a definitions.Artifact) (*oci.Image, error) {
+	p := oci.Platform{OS: b.OS, Architecture: b.Arch}
+	img := oci.Scratch(p)
+
+	if ib.base != nil {
+		var err error
+
+		if img, err = ib.base.Image(ib.baseRef, p); err != nil {
+			return nil, err
+		}
+	}
+
+	bin := path.Join(imageBinaryDir, b.Name())
+
+	img.Config.Config.Entrypoint = []string{bin}
+	img.Config.Config.Cmd = nil
+	img.Config.Config.Labels = maps.Clone(img.Config.Config.Labels)
+
+	if img.Config.Config.Labels == nil {
+		img.Config.Config.Labels = make(map[string]string)
+	}
+
+	maps.Copy(img.Config.Config.Labels, ib.labels)
+
+	if b.Version != "" {
+		img.Config.Config.Labels[oci.AnnotationVersion] = b.Version
+	}
+
+	if err := img.AppendLayer(
+		[]oci.File{{Path: bin, Mode: 0755, Source: filepath.Join(ib.distDir, a.Path)}},
+		ib.created,
+		fmt.Sprintf("compile-go: COPY %s %s", a.Path, bin),
+	); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// build assembles an image per executable out of its linux binaries, one
+// manifest per architecture gathered in an index, and either pushes it or
+// writes it as an OCI layout tarball in the dist dir.
+func (ib *imageBuilder) build(ctx context.Context, bs []build, defs definitions.Definitions, cctx toolkit.CommandContext) ([]definitions.Image, error) {
+	var (
+		paths []string
+
+		targets      = make(map[string][]build)
+		repositories = make(map[string]string)
+		layouts      = make(map[string]string)
+	)
+
+	for _, b := range bs {
+		if _, ok := targets[b.Path]; !ok {
+			paths = append(paths, b.Path)
+			targets[b.Path] = nil
+		}
+
+		if b.OS == "linux" {
+			targets[b.Path] = append(targets[b.Path], b)
+		}
+	}
+
+	var imgs []definitions.Image
+
+	for _, p := range paths {
+		ts := targets[p]
+
+		if len(ts) == 0 {
+			cctx.Logger.Warningf("Skipping the image of %s: no linux target", p)
+			continue
+		}
+
+		r, err := ib.reference(ts[0])
+
+		if err != nil {
+			return nil, err
+		}
+
+		repo := r.Registry + "/" + r.Repository
+
+		if op, ok := repositories[repo]; ok {
+			return nil, fmt.Errorf("image-name renders %s for both %s and %s", repo, op, p)
+		}
+
+		repositories[repo] = p
+
+		if ib.credential != nil {
+			ib.client.Credentials[r.Registry] = *ib.credential
+		}
+
+		ii := oci.ImageIndex{
+			Annotations: map[string]string{
+				oci.AnnotationCreated: ib.created.Format(time.RFC3339),
+			},
+		}
+
+		di := definitions.Image{
+			Name:       ts[0].Name(),
+			Module:     ts[0].Module.Path,
+			Version:    ts[0].Version,
+			Repository: repo,
+			Tags:       ib.imageTags(ts[0]),
+		}
+
+		for _, b := range ts {
+			a, ok := defs.Lookup(b.Name(), b.archKey())
+
+			if !ok {
+				return nil, fmt.Errorf("no binary was built for %s (%s)", p, b.archKey())
+			}
+
+			img, err := ib.image(b, a)
+
+			if err != nil {
+				return nil, errors.Wrapf(err, "cant assemble the image of %s (%s)", p, b.archKey())
+			}
+
+			ii.Images = append(ii.Images, img)
+			di.Platforms = append(di.Platforms, img.Platform().String())
+		}
+
+		var d oci.Descriptor
+
+		if ib.push {
+			d, err = ib.client.Push(ctx, r.WithTag(di.Tags[0]), ii, di.Tags[1:]...)
+		} else {
+			di.Path = layoutFilename(r)
+
+			if op, ok := layouts[di.Path]; ok {
+				return nil, fmt.Errorf("the images of %s and %s both write %s", op, p, di.Path)
+			}
+
+			layouts[di.Path] = p
+			d, err = ib.writeLayout(di.Path, r, di.Tags, ii)
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "cant publish the image of %s", p)
+		}
+
+		di.Digest = d.Digest.String()
+
+		cctx.Logger.Noticef("Assembled %s@%s (%s)", repo, di.Digest, strings.Join(di.Platforms, ", "))
+
+		imgs = append(imgs, di)
+	}
+
+	return imgs, nil
+}
+
+var layoutReplacer = strings.NewReplacer("/", "_", ":", "_")
+
+func layoutFilename(r oci.Reference) string {
+	return layoutReplacer.Replace(r.Registry+"/"+r.Repository) + ".oci.tar"
+}
+
+func (ib *imageBuilder) writeLayout(fname string, r oci.Reference, tags []string, ii oci.ImageIndex) (oci.Descriptor, error) {
+	root, err := ii.Root()
+
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	f, err := os.Create(filepath.Join(ib.distDir, fname))
+
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	var refs []oci.Reference
+
+	for _, t := range tags {
+		refs = append(refs, r.WithTag(t))
+	}
+
+	if err := oci.WriteLayout(f, ii, refs...); err != nil {
+		f.Close()
+		return oci.Descriptor{}, err
+	}
+
+	return root.Descriptor, f.Close()
+}
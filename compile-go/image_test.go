@@ -0,0 +1,205 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/definitions"
+	"github.com/upfluence/actions/pkg/oci"
+)
+
+func readLayoutIndex(t testing.TB, fname string) oci.Index {
+	f, err := os.Open(fname)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+
+	for {
+		h, err := tr.Next()
+		require.NoError(t, err)
+
+		if h.Name != "index.json" {
+			continue
+		}
+
+		var idx oci.Index
+
+		buf, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(buf, &idx))
+
+		return idx
+	}
+}
+
+func TestImageBuilderLayout(t *testing.T) {
+	var (
+		dist = t.TempDir()
+		cctx = testCommandContext(t)
+
+		c = config{
+			DistDir:         dist,
+			ImageTags:       []string{"v1.2.0", "latest"},
+			ImageLabels:     map[string]string{"org.opencontainers.image.vendor": "upfluence"},
+			SourceDateEpoch: 1700000000,
+		}
+
+		defs definitions.Definitions
+		bs   []build
+	)
+
+	require.NoError(t, c.ImageName.Parse("ghcr.io/upfluence/{{ .Name }}"))
+
+	for _, target := range [][2]string{{"linux", "amd64"}, {"linux", "arm64"}, {"darwin", "arm64"}} {
+		b := build{Path: "cmd/foo", Version: "v1.2.0", OS: target[0], Arch: target[1]}
+		fname := "foo-" + target[0] + "-" + target[1]
+
+		require.NoError(t, os.WriteFile(filepath.Join(dist, fname), []byte(fname), 0755))
+
+		bs = append(bs, b)
+		defs.Artifacts = append(
+			defs.Artifacts,
+			definitions.Artifact{Name: "foo", Kind: definitions.Binary, Path: fname, OS: b.OS, Arch: b.Arch},
+		)
+	}
+
+	// executables without linux targets are skipped
+	bs = append(bs, build{Path: "cmd/bar", OS: "windows", Arch: "amd64"})
+
+	ib, err := c.imageBuilder(cctx)
+	require.NoError(t, err)
+
+	imgs, err := ib.build(context.Background(), bs, defs, cctx)
+	require.NoError(t, err)
+	require.Len(t, imgs, 1)
+
+	img := imgs[0]
+
+	assert.Equal(t, "foo", img.Name)
+	assert.Equal(t, "ghcr.io/upfluence/foo", img.Repository)
+	assert.Equal(t, []string{"v1.2.0", "latest"}, img.Tags)
+	assert.Equal(t, []string{"linux/amd64", "linux/arm64"}, img.Platforms)
+	assert.Equal(t, "ghcr.io_upfluence_foo.oci.tar", img.Path)
+
+	idx := readLayoutIndex(t, filepath.Join(dist, img.Path))
+	require.Len(t, idx.Manifests, 2)
+
+	assert.Equal(t, oci.Digest(img.Digest), idx.Manifests[0].Digest)
+	assert.Equal(t, "latest", idx.Manifests[1].Annotations[oci.AnnotationRefName])
+
+	// images are reproducible
+	imgs2, err := ib.build(context.Background(), bs, defs, cctx)
+	require.NoError(t, err)
+	assert.Equal(t, img.Digest, imgs2[0].Digest)
+}
+
+func TestImageBuilderBase(t *testing.T) {
+	var (
+		dist = t.TempDir()
+		base = t.TempDir()
+		cctx = testCommandContext(t)
+
+		bs = []build{{Path: "cmd/foo", Version: "v1.2.0+abc", OS: "linux", Arch: "amd64"}}
+
+		defs = definitions.Definitions{
+			Artifacts: []definitions.Artifact{{Name: "foo", Path: "foo", OS: "linux", Arch: "amd64"}},
+		}
+	)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dist, "foo"), []byte("foo"), 0755))
+
+	// the base layout holds an arm64 image only
+	f, err := os.Create(filepath.Join(base, "base.tar"))
+	require.NoError(t, err)
+	require.NoError(t, oci.WriteLayout(f, oci.Scratch(oci.Platform{OS: "linux", Architecture: "arm64"})))
+	require.NoError(t, f.Close())
+
+	c := config{DistDir: dist, ImageBase: filepath.Join(base, "missing")}
+	require.NoError(t, c.ImageName.Parse("upfluence/{{ .Name }}"))
+
+	_, err = c.imageBuilder(cctx)
+	assert.Error(t, err)
+
+	dir := filepath.Join(base, "layout")
+	require.NoError(t, untar(filepath.Join(base, "base.tar"), dir))
+
+	c.ImageBase = dir
+
+	ib, err := c.imageBuilder(cctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"v1.2.0_abc"}, ib.imageTags(bs[0]))
+
+	_, err = ib.build(context.Background(), bs, defs, cctx)
+	assert.ErrorIs(t, err, oci.ErrPlatformNotFound)
+
+	require.NoError(t, c.ImageName.Parse("upfluence/foo:latest"))
+
+	ib, err = c.imageBuilder(cctx)
+	require.NoError(t, err)
+
+	_, err = ib.build(context.Background(), bs, defs, cctx)
+	assert.ErrorContains(t, err, "holds a tag")
+}
+
+func TestLayoutFilename(t *testing.T) {
+	for in, out := range map[string]string{
+		"ghcr.io/a/foo":       "ghcr.io_a_foo.oci.tar",
+		"quay.io/b/foo":       "quay.io_b_foo.oci.tar",
+		"localhost:5000/foo":  "localhost_5000_foo.oci.tar",
+		"upfluence/foo:1.0.0": "docker.io_upfluence_foo.oci.tar",
+	} {
+		r, err := oci.ParseReference(in)
+		require.NoError(t, err)
+
+		assert.Equal(t, out, layoutFilename(r), in)
+	}
+}
+
+func untar(fname, dir string) error {
+	f, err := os.Open(fname)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+
+	for {
+		h, err := tr.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(h.Name))
+
+		if h.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := writeArchiveFile(target, tr, 0644); err != nil {
+			return err
+		}
+	}
+}
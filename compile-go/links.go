@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+type linkerMode string
+
+var linkerPresets = map[linkerMode]map[string]string{
+	"none": {},
+	"pkg": {
+		"github.com/upfluence/pkg/peer.Version":   "{{ .Version }}",
+		"github.com/upfluence/pkg/peer.GitCommit": "{{ .Sha }}",
+		"github.com/upfluence/pkg/peer.GitBranch": "{{ .RefName }}",
+		"github.com/upfluence/pkg/peer.GitRemote": "https://github.com/{{ .Repository }}",
+	},
+	"cli": {
+		"github.com/upfluence/cfg/x/cli.Version": "{{ .Version }}",
+	},
+}
+
+func (lm *linkerMode) Parse(v string) error {
+	if _, ok := linkerPresets[linkerMode(v)]; !ok {
+		return fmt.Errorf("Invalid linker-mode %q", v)
+	}
+
+	*lm = linkerMode(v)
+
+	return nil
+}
+
+type linkContext struct {
+	Version    string
+	Sha        string
+	RefName    string
+	BuildTime  string
+	Repository string
+
+	Module    string
+	ModuleDir string
+}
+
+func (c config) linkContext(cctx toolkit.CommandContext, m goModule) linkContext {
+	t := time.Now()
+
+	// honor https://reproducible-builds.org/specs/source-date-epoch/ so the
+	// rendered links, and therefore the build cache key, stay stable
+	if c.SourceDateEpoch > 0 {
+		t = time.Unix(c.SourceDateEpoch, 0)
+	}
+
+	return linkContext{
+		Version:    c.moduleVersion(m),
+		Sha:        cctx.Sha,
+		RefName:    cctx.RefName,
+		BuildTime:  t.UTC().Format(time.RFC3339),
+		Repository: cctx.Repository,
+		Module:     m.Path,
+		ModuleDir:  m.Dir,
+	}
+}
+
+func (c config) links(cctx toolkit.CommandContext, m goModule) (map[string]string, error) {
+	var (
+		lctx = c.linkContext(cctx, m)
+		ls   = make(map[string]string)
+	)
+
+	for _, vs := range []map[string]string{linkerPresets[c.LinkerMode], c.AdditionalLinks} {
+		for k, v := range vs {
+			t, err := template.New(k).Option("missingkey=error").Parse(v)
+
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid link template for %q", k)
+			}
+
+			var buf bytes.Buffer
+
+			if err := t.Execute(&buf, lctx); err != nil {
+				return nil, errors.Wrapf(err, "cant render link template for %q", k)
+			}
+
+			ls[k] = buf.String()
+		}
+	}
+
+	return ls, nil
+}
+
+func splitSymbol(sym string) (string, string) {
+	i := strings.LastIndex(sym, ".")
+
+	if i < 0 {
+		return "", sym
+	}
+
+	return sym[:i], sym[i+1:]
+}
+
+func (c *compiler) output(ctx context.Context, env map[string]string, args ...string) (string, error) {
+	var buf bytes.Buffer
+
+	err := c.executor.Exec(
+		ctx,
+		executil.Command{Cmd: c.path, Args: args, Env: env, Stdout: &buf},
+	)
+
+	return buf.String(), err
+}
+
+func parseNMSymbols(out string) map[string]struct{} {
+	syms := make(map[string]struct{})
+	s := bufio.NewScanner(strings.NewReader(out))
+
+	for s.Scan() {
+		fs := strings.Fields(s.Text())
+
+		if len(fs) != 3 {
+			continue
+		}
+
+		switch fs[1] {
+		case "D", "B", "d", "b":
+			syms[fs[2]] = struct{}{}
+		}
+	}
+
+	return syms
+}
+
+// checkLinks makes sure every -X target is an actual variable of the
+// package it refers to, the linker silently ignores unknown symbols. The
+// binary itself is stripped so the symbols are looked up in the compiled
+// package archives.
+func (c *compiler) checkLinks(ctx context.Context, b build, env map[string]string) error {
+	var (
+		missing []string
+
+		byPkg = make(map[string][]string)
+	)
+
+	for _, k := range slices.Sorted(maps.Keys(b.links)) {
+		pkg, _ := splitSymbol(k)
+		byPkg[pkg] = append(byPkg[pkg], k)
+	}
+
+	for _, pkg := range slices.Sorted(maps.Keys(byPkg)) {
+		target := pkg
+
+		if pkg == "main" {
+			target = "./" + b.Path
+		}
+
+		export, err := c.output(
+			ctx,
+			env,
+			append(append([]string{"list", "-export", "-f", "{{ .Export }}"}, c.tagArgs()...), target)...,
+		)
+
+		if err != nil {
+			return errors.Wrapf(err, "cant locate the archive of %q", pkg)
+		}
+
+		out, err := c.output(ctx, env, "tool", "nm", strings.TrimSpace(export))
+
+		if err != nil {
+			return errors.Wrapf(err, "cant list the symbols of %q", pkg)
+		}
+
+		syms := parseNMSymbols(out)
+
+		for _, k := range byPkg[pkg] {
+			if _, ok := syms[k]; !ok {
+				missing = append(missing, k)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf(
+			"link targets not found in %s: %s",
+			b.archKey(),
+			strings.Join(missing, ", "),
+		)
+	}
+
+	return nil
+}
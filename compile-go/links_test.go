@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+func TestConfigLinks(t *testing.T) {
+	cctx := testCommandContext(t)
+
+	for _, tt := range []struct {
+		name string
+		c    config
+
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "pkg preset",
+			c:    config{Version: "v1.0.0", LinkerMode: "pkg"},
+			want: map[string]string{
+				"github.com/upfluence/pkg/peer.Version":   "v1.0.0",
+				"github.com/upfluence/pkg/peer.GitCommit": "0123456789abcdef",
+				"github.com/upfluence/pkg/peer.GitBranch": "main",
+				"github.com/upfluence/pkg/peer.GitRemote": "https://github.com/upfluence/foo",
+			},
+		},
+		{
+			name: "templated additional links",
+			c: config{
+				Version:         "v1.0.0",
+				LinkerMode:      "cli",
+				SourceDateEpoch: 1704067200,
+				AdditionalLinks: map[string]string{
+					"main.BuildTime": "{{ .BuildTime }}",
+					"main.Static":    "foo",
+				},
+			},
+			want: map[string]string{
+				"github.com/upfluence/cfg/x/cli.Version": "v1.0.0",
+				"main.BuildTime":                         "2024-01-01T00:00:00Z",
+				"main.Static":                            "foo",
+			},
+		},
+		{
+			name: "unknown field",
+			c: config{
+				AdditionalLinks: map[string]string{"main.Foo": "{{ .Foo }}"},
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ls, err := tt.c.links(cctx, goModule{})
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ls)
+		})
+	}
+}
+
+func TestLinkerModeParse(t *testing.T) {
+	var lm linkerMode
+
+	assert.NoError(t, lm.Parse("cli"))
+	assert.Equal(t, linkerMode("cli"), lm)
+	assert.Error(t, lm.Parse("foo"))
+}
+
+func TestCheckLinks(t *testing.T) {
+	exc := fakeExecutorWith(
+		execHandlers{
+			"list": func(cmd executil.Command) error {
+				_, err := io.WriteString(cmd.Stdout, "/cache/"+cmd.Args[len(cmd.Args)-1]+"\n")
+				return err
+			},
+			"tool": func(cmd executil.Command) error {
+				var out string
+
+				switch cmd.Args[2] {
+				case "/cache/github.com/upfluence/cfg/x/cli":
+					out = "     5b9 B github.com/upfluence/cfg/x/cli.Version\n"
+				case "/cache/./cmd/foo":
+					out = "         U fmt.Println\n     5e3 D main.Commit\n     5b8 T main.main\n"
+				}
+
+				_, err := io.WriteString(cmd.Stdout, out)
+				return err
+			},
+		},
+	)
+
+	cp := compiler{path: "go", executor: exc}
+	b := build{
+		Path: "cmd/foo",
+		OS:   "linux",
+		Arch: "amd64",
+		links: map[string]string{
+			"github.com/upfluence/cfg/x/cli.Version": "v1.0.0",
+			"main.Commit":                            "abc",
+		},
+	}
+
+	assert.NoError(t, cp.checkLinks(context.Background(), b, nil))
+
+	b.links["main.main"] = "foo"
+	b.links["main.Missing"] = "foo"
+
+	assert.EqualError(
+		t,
+		cp.checkLinks(context.Background(), b, nil),
+		"link targets not found in linux/amd64: main.Missing, main.main",
+	)
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"crypto/rand"
+	"debug/buildinfo"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/definitions"
+)
+
+type sbomFormat int
+
+const (
+	cycloneDX sbomFormat = iota
+	spdx
+)
+
+func (sf *sbomFormat) Parse(v string) error {
+	switch v {
+	case "cyclonedx":
+		*sf = cycloneDX
+	case "spdx":
+		*sf = spdx
+	default:
+		return fmt.Errorf("Invalid sbom-format %q", v)
+	}
+
+	return nil
+}
+
+func (sf sbomFormat) String() string {
+	if sf == spdx {
+		return "spdx"
+	}
+
+	return "cyclonedx"
+}
+
+func (sf sbomFormat) extension() string {
+	if sf == spdx {
+		return ".spdx.json"
+	}
+
+	return ".cdx.json"
+}
+
+func (sf sbomFormat) document(s sbomSubject) any {
+	if sf == spdx {
+		return s.spdx()
+	}
+
+	return s.cycloneDX()
+}
+
+type sbomSubject struct {
+	name    string
+	version string
+	sha256  string
+	repo    string
+	created time.Time
+
+	info *debug.BuildInfo
+}
+
+func modulePURL(m *debug.Module) string {
+	if m.Version == "" || m.Version == "(devel)" {
+		return fmt.Sprintf("pkg:golang/%s", m.Path)
+	}
+
+	return fmt.Sprintf("pkg:golang/%s@%s", m.Path, m.Version)
+}
+
+// sumDigest decodes the h1: digest recorded in go.sum into its hexadecimal
+// SHA-256 representation.
+func sumDigest(sum string) string {
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sum, "h1:"))
+
+	if err != nil || !strings.HasPrefix(sum, "h1:") {
+		return ""
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+func resolvedModule(m *debug.Module) *debug.Module {
+	if m.Replace != nil {
+		return m.Replace
+	}
+
+	return m
+}
+
+func (s sbomSubject) mainModule() *debug.Module {
+	m := s.info.Main
+
+	if s.version != "" {
+		m.Version = s.version
+	}
+
+	return &m
+}
+
+func newUUID() string {
+	var buf [16]byte
+
+	rand.Read(buf[:])
+
+	buf[6] = (buf[6] & 0x0f) | 0x40
+	buf[8] = (buf[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:])
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxComponent struct {
+	BOMRef     string        `json:"bom-ref"`
+	Type       string        `json:"type"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Hashes     []cdxHash     `json:"hashes,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+type cdxDocument struct {
+	BOMFormat    string `json:"bomFormat"`
+	SpecVersion  string `json:"specVersion"`
+	SerialNumber string `json:"serialNumber"`
+	Version      int    `json:"version"`
+
+	Metadata struct {
+		Timestamp string `json:"timestamp"`
+
+		Tools struct {
+			Components []cdxComponent `json:"components"`
+		} `json:"tools"`
+
+		Component cdxComponent `json:"component"`
+	} `json:"metadata"`
+
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+func (s sbomSubject) cycloneDX() cdxDocument {
+	var (
+		doc = cdxDocument{
+			BOMFormat:    "CycloneDX",
+			SpecVersion:  "1.5",
+			SerialNumber: "urn:uuid:" + newUUID(),
+			Version:      1,
+		}
+
+		main = s.mainModule()
+		root = cdxDependency{Ref: modulePURL(main)}
+	)
+
+	doc.Metadata.Timestamp = s.created.UTC().Format(time.RFC3339)
+	doc.Metadata.Tools.Components = []cdxComponent{
+		{BOMRef: "compile-go", Type: "application", Name: "compile-go"},
+	}
+
+	doc.Metadata.Component = cdxComponent{
+		BOMRef:  root.Ref,
+		Type:    "application",
+		Name:    s.name,
+		Version: main.Version,
+		PURL:    root.Ref,
+		Hashes:  []cdxHash{{Alg: "SHA-256", Content: s.sha256}},
+		Properties: []cdxProperty{
+			{Name: "golang:package", Value: s.info.Path},
+			{Name: "golang:version", Value: s.info.GoVersion},
+		},
+	}
+
+	for _, bs := range s.info.Settings {
+		doc.Metadata.Component.Properties = append(
+			doc.Metadata.Component.Properties,
+			cdxProperty{Name: "golang:build:" + bs.Key, Value: bs.Value},
+		)
+	}
+
+	for _, dep := range s.info.Deps {
+		m := resolvedModule(dep)
+
+		c := cdxComponent{
+			BOMRef:  modulePURL(m),
+			Type:    "library",
+			Name:    m.Path,
+			Version: m.Version,
+			PURL:    modulePURL(m),
+		}
+
+		if d := sumDigest(m.Sum); d != "" {
+			c.Hashes = []cdxHash{{Alg: "SHA-256", Content: d}}
+		}
+
+		doc.Components = append(doc.Components, c)
+		doc.Dependencies = append(doc.Dependencies, cdxDependency{Ref: c.BOMRef})
+		root.DependsOn = append(root.DependsOn, c.BOMRef)
+	}
+
+	doc.Dependencies = append([]cdxDependency{root}, doc.Dependencies...)
+
+	return doc
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxAnnotation struct {
+	AnnotationType string `json:"annotationType"`
+	Annotator      string `json:"annotator"`
+	AnnotationDate string `json:"annotationDate"`
+	Comment        string `json:"comment"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Annotations      []spdxAnnotation  `json:"annotations,omitempty"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+type spdxDocument struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	DataLicense       string `json:"dataLicense"`
+	SPDXID            string `json:"SPDXID"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+
+	CreationInfo struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	} `json:"creationInfo"`
+
+	Packages      []spdxPackage      `json:"packages"`
+	Relationships []spdxRelationship `json:"relationships"`
+}
+
+func spdxPackageOf(id string, m *debug.Module) spdxPackage {
+	p := spdxPackage{
+		Name:             m.Path,
+		SPDXID:           id,
+		VersionInfo:      m.Version,
+		DownloadLocation: "NOASSERTION",
+		ExternalRefs: []spdxExternalRef{
+			{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  modulePURL(m),
+			},
+		},
+	}
+
+	if d := sumDigest(m.Sum); d != "" {
+		p.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: d}}
+	}
+
+	return p
+}
+
+func (s sbomSubject) spdx() spdxDocument {
+	var (
+		created = s.created.UTC().Format(time.RFC3339)
+		tool    = "Tool: compile-go"
+
+		doc = spdxDocument{
+			SPDXVersion: "SPDX-2.3",
+			DataLicense: "CC0-1.0",
+			SPDXID:      "SPDXRef-DOCUMENT",
+			Name:        s.name,
+			DocumentNamespace: fmt.Sprintf(
+				"https://github.com/%s/sbom/%s-%s",
+				s.repo,
+				s.name,
+				newUUID(),
+			),
+		}
+
+		root = spdxPackageOf("SPDXRef-Package-main", s.mainModule())
+	)
+
+	doc.CreationInfo.Created = created
+	doc.CreationInfo.Creators = []string{tool}
+
+	root.Name = s.name
+	root.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: s.sha256}}
+
+	for _, bs := range append(
+		[]debug.BuildSetting{{Key: "GOVERSION", Value: s.info.GoVersion}},
+		s.info.Settings...,
+	) {
+		root.Annotations = append(
+			root.Annotations,
+			spdxAnnotation{
+				AnnotationType: "OTHER",
+				Annotator:      tool,
+				AnnotationDate: created,
+				Comment:        fmt.Sprintf("%s=%s", bs.Key, bs.Value),
+			},
+		)
+	}
+
+	doc.Packages = []spdxPackage{root}
+	doc.Relationships = []spdxRelationship{
+		{
+			SPDXElementID:      doc.SPDXID,
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: root.SPDXID,
+		},
+	}
+
+	for i, dep := range s.info.Deps {
+		p := spdxPackageOf(fmt.Sprintf("SPDXRef-Package-%d", i), resolvedModule(dep))
+
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(
+			doc.Relationships,
+			spdxRelationship{
+				SPDXElementID:      root.SPDXID,
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSPDXElement: p.SPDXID,
+			},
+		)
+	}
+
+	return doc
+}
+
+func (c *compiler) sboms(fname string) []definitions.SBOM {
+	var sboms []definitions.SBOM
+
+	for _, sf := range c.sbomFormats {
+		sboms = append(sboms, definitions.SBOM{Format: sf.String(), Path: fname + sf.extension()})
+	}
+
+	return sboms
+}
+
+// buildInfo reads the build info of the binary, it has to be read before
+// the binary is packed by upx.
+func (c *compiler) buildInfo(fname string) (*buildinfo.BuildInfo, error) {
+	if len(c.sbomFormats) == 0 {
+		return nil, nil
+	}
+
+	filename := filepath.Join(c.distDir, fname)
+
+	bi, err := buildinfo.ReadFile(filename)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "cant read build info of %q", filename)
+	}
+
+	return bi, nil
+}
+
+func (c *compiler) writeSBOMs(b build, fname, sum string, bi *buildinfo.BuildInfo) ([]definitions.SBOM, error) {
+	if bi == nil {
+		return nil, nil
+	}
+
+	s := sbomSubject{
+		name:    b.Name(),
+		version: b.Version,
+		sha256:  sum,
+		repo:    c.repo,
+		created: c.sbomCreated,
+		info:    bi,
+	}
+
+	for _, sf := range c.sbomFormats {
+		buf, err := json.MarshalIndent(sf.document(s), "", "  ")
+
+		if err != nil {
+			return nil, err
+		}
+
+		sbom := fname + sf.extension()
+
+		if err := os.WriteFile(filepath.Join(c.distDir, sbom), buf, 0644); err != nil {
+			return nil, errors.Wrapf(err, "cant write %q", sbom)
+		}
+	}
+
+	return c.sboms(fname), nil
+}
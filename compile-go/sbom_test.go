@@ -0,0 +1,84 @@
+package main
+
+import (
+	"debug/buildinfo"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSBOMSubject(t testing.TB) sbomSubject {
+	bi, err := buildinfo.ReadFile(os.Args[0])
+	require.NoError(t, err)
+
+	return sbomSubject{
+		name:    "foo",
+		version: "v1.2.3",
+		sha256:  "deadbeef",
+		repo:    "upfluence/foo",
+		created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		info:    bi,
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	s := testSBOMSubject(t)
+	doc := s.cycloneDX()
+
+	assert.Equal(t, "CycloneDX", doc.BOMFormat)
+	assert.Equal(t, "2024-01-01T00:00:00Z", doc.Metadata.Timestamp)
+	assert.Equal(t, "v1.2.3", doc.Metadata.Component.Version)
+	assert.Equal(t, "pkg:golang/"+s.info.Main.Path+"@v1.2.3", doc.Metadata.Component.PURL)
+	assert.Equal(t, []cdxHash{{Alg: "SHA-256", Content: "deadbeef"}}, doc.Metadata.Component.Hashes)
+
+	require.Len(t, doc.Components, len(s.info.Deps))
+	require.Len(t, doc.Dependencies, len(s.info.Deps)+1)
+	assert.Len(t, doc.Dependencies[0].DependsOn, len(s.info.Deps))
+
+	var found bool
+
+	for _, c := range doc.Components {
+		if c.Name == "github.com/stretchr/testify" {
+			found = true
+			require.Len(t, c.Hashes, 1)
+			assert.Len(t, c.Hashes[0].Content, 64)
+		}
+	}
+
+	assert.True(t, found)
+}
+
+func TestSPDX(t *testing.T) {
+	s := testSBOMSubject(t)
+	doc := s.spdx()
+
+	assert.Equal(t, "SPDX-2.3", doc.SPDXVersion)
+	assert.Equal(t, "foo", doc.Packages[0].Name)
+	assert.Equal(t, "v1.2.3", doc.Packages[0].VersionInfo)
+	assert.Len(t, doc.Packages, len(s.info.Deps)+1)
+	assert.Len(t, doc.Relationships, len(s.info.Deps)+1)
+	assert.Equal(t, "DESCRIBES", doc.Relationships[0].RelationshipType)
+	assert.Contains(t, doc.DocumentNamespace, "https://github.com/upfluence/foo/sbom/foo-")
+}
+
+func TestCompilerSBOMCreated(t *testing.T) {
+	cp, err := newCompiler(
+		config{DistDir: t.TempDir(), CompilerPath: "go", SourceDateEpoch: 1704067200},
+		testCommandContext(t),
+	)
+	require.NoError(t, err)
+
+	assert.True(t, cp.sbomCreated.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestSumDigest(t *testing.T) {
+	assert.Equal(
+		t,
+		"1c5df9c5ea2a2e4d2c22e7bd1c41fd6d8b97ceaedcb9fe1f2a9ff46cd01bcc48",
+		sumDigest("h1:HF35xeoqLk0sIue9HEH9bYuXzq7cuf4fKp/0bNAbzEg="),
+	)
+	assert.Equal(t, "", sumDigest("h2:foo"))
+}
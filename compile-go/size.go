@@ -0,0 +1,361 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+type budgetAction int
+
+const (
+	warnBudget budgetAction = iota
+	failBudget
+)
+
+func (ba *budgetAction) Parse(v string) error {
+	switch v {
+	case "warn", "":
+		*ba = warnBudget
+	case "fail":
+		*ba = failBudget
+	default:
+		return fmt.Errorf("Invalid size-budget-action %q", v)
+	}
+
+	return nil
+}
+
+type sizeBudget struct {
+	threshold float64
+	action    budgetAction
+}
+
+func (c config) sizeBudget() sizeBudget {
+	return sizeBudget{threshold: c.SizeBudget, action: c.SizeBudgetAction}
+}
+
+// exceeded returns the growth in percent of cur compared to prev and
+// whether it goes beyond the budget.
+func (sb sizeBudget) exceeded(prev, cur int64) (float64, bool) {
+	if prev <= 0 {
+		return 0, false
+	}
+
+	growth := float64(cur-prev) * 100 / float64(prev)
+
+	return growth, sb.threshold > 0 && growth > sb.threshold
+}
+
+type binarySizes struct {
+	Raw        int64 `json:"raw"`
+	Stripped   int64 `json:"stripped"`
+	Compressed int64 `json:"compressed"`
+	Packed     bool  `json:"packed,omitempty"`
+}
+
+func isDebugSection(name string) bool {
+	for _, prefix := range []string{".debug", ".zdebug", "__debug", "__zdebug"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return name == ".symtab" || name == ".strtab"
+}
+
+// debugSize sums the size of the symbol and debug sections which would be
+// dropped by a strip.
+func debugSize(fname string) int64 {
+	var size int64
+
+	if f, err := elf.Open(fname); err == nil {
+		defer f.Close()
+
+		for _, s := range f.Sections {
+			if isDebugSection(s.Name) && s.Type != elf.SHT_NOBITS {
+				size += int64(s.Size)
+			}
+		}
+
+		return size
+	}
+
+	if f, err := macho.Open(fname); err == nil {
+		defer f.Close()
+
+		if s := f.Segment("__DWARF"); s != nil {
+			size += int64(s.Filesz)
+		}
+
+		return size
+	}
+
+	if f, err := pe.Open(fname); err == nil {
+		defer f.Close()
+
+		for _, s := range f.Sections {
+			if isDebugSection(s.Name) {
+				size += int64(s.Size)
+			}
+		}
+
+		return size
+	}
+
+	if f, err := macho.OpenFat(fname); err == nil {
+		defer f.Close()
+
+		for _, a := range f.Arches {
+			if s := a.Segment("__DWARF"); s != nil {
+				size += int64(s.Filesz)
+			}
+		}
+	}
+
+	return size
+}
+
+type countingWriter int64
+
+func (cw *countingWriter) Write(buf []byte) (int, error) {
+	*cw += countingWriter(len(buf))
+	return len(buf), nil
+}
+
+func gzipSize(fname string) (int64, error) {
+	f, err := os.Open(fname)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	var cw countingWriter
+
+	w, _ := gzip.NewWriterLevel(&cw, gzip.BestCompression)
+
+	if _, err := io.Copy(w, f); err != nil {
+		return 0, err
+	}
+
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+
+	return int64(cw), nil
+}
+
+func measure(fname string) (binarySizes, error) {
+	fi, err := os.Stat(fname)
+
+	if err != nil {
+		return binarySizes{}, errors.Wrapf(err, "cant stat %q", fname)
+	}
+
+	gz, err := gzipSize(fname)
+
+	if err != nil {
+		return binarySizes{}, errors.Wrapf(err, "cant compress %q", fname)
+	}
+
+	return binarySizes{
+		Raw:        fi.Size(),
+		Stripped:   fi.Size() - debugSize(fname),
+		Compressed: gz,
+	}, nil
+}
+
+func isPackable(b build) bool {
+	return b.OS == "linux" || b.OS == "windows"
+}
+
+func (c *compiler) pack(ctx context.Context, b build, fname string, sizes *binarySizes, cctx toolkit.CommandContext) (string, error) {
+	filename := filepath.Join(c.distDir, fname)
+
+	if !isPackable(b) {
+		cctx.Logger.Noticef("Skipping UPX compression of %s: %s is not supported", filename, b.OS)
+		return hashFile(filename)
+	}
+
+	if err := c.executor.Exec(
+		ctx,
+		executil.Command{
+			Cmd:    "upx",
+			Args:   []string{"-q", "--best", filename},
+			Stdout: cctx.CommandContext.Stdout,
+			Stderr: cctx.CommandContext.Stderr,
+		},
+	); err != nil {
+		return "", errors.Wrapf(err, "cant compress %q with upx", filename)
+	}
+
+	fi, err := os.Stat(filename)
+
+	if err != nil {
+		return "", err
+	}
+
+	sizes.Compressed = fi.Size()
+	sizes.Packed = true
+
+	return hashFile(filename)
+}
+
+type sizeReport struct {
+	build    build
+	filename string
+	sizes    binarySizes
+}
+
+func (sr sizeReport) size() int64 {
+	if sr.sizes.Packed {
+		return sr.sizes.Compressed
+	}
+
+	return sr.sizes.Raw
+}
+
+// previousAssetSizes returns the size of the assets attached to the latest
+// release of the repository.
+func previousAssetSizes(ctx context.Context, cctx toolkit.CommandContext) (string, map[string]int64, error) {
+	org, repo := cctx.SplittedRepository()
+
+	r, _, err := cctx.Client.Repositories.GetLatestRelease(ctx, org, repo)
+
+	var ghErr *github.ErrorResponse
+
+	if errors.As(err, &ghErr) && ghErr.Response.StatusCode == http.StatusNotFound {
+		return "", nil, nil
+	}
+
+	if err != nil {
+		return "", nil, errors.Wrap(err, "cant fetch the latest release")
+	}
+
+	sizes := make(map[string]int64, len(r.Assets))
+
+	for _, a := range r.Assets {
+		sizes[a.GetName()] = int64(a.GetSize())
+	}
+
+	return r.GetTagName(), sizes, nil
+}
+
+func formatSize(v int64) string {
+	const unit = 1024
+
+	if v < unit {
+		return fmt.Sprintf("%d B", v)
+	}
+
+	d, exp := int64(unit), 0
+
+	for n := v / unit; n >= unit; n /= unit {
+		d *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(v)/float64(d), "KMGTPE"[exp])
+}
+
+func (c *compiler) reportSizes(ctx context.Context, cctx toolkit.CommandContext, sb sizeBudget) error {
+	if len(c.sizes) == 0 {
+		return nil
+	}
+
+	var (
+		tag     string
+		prev    map[string]int64
+		exceeds []string
+		rows    [][]string
+	)
+
+	if sb.threshold > 0 {
+		var err error
+
+		if tag, prev, err = previousAssetSizes(ctx, cctx); err != nil {
+			return err
+		}
+	}
+
+	for _, sr := range c.sizes {
+		compressed := formatSize(sr.sizes.Compressed) + " (gzip)"
+
+		if sr.sizes.Packed {
+			compressed = formatSize(sr.sizes.Compressed) + " (upx)"
+		}
+
+		delta := "-"
+
+		if tag != "" {
+			pb := sr.build
+			pb.Version = tag
+
+			if name, err := c.nt.render(pb); err == nil {
+				if ps, ok := prev[filepath.Base(name)]; ok {
+					growth, exceeded := sb.exceeded(ps, sr.size())
+					delta = fmt.Sprintf("%+.1f%%", growth)
+
+					if exceeded {
+						exceeds = append(
+							exceeds,
+							fmt.Sprintf("%s grew by %.1f%% since %s", sr.filename, growth, tag),
+						)
+					}
+				}
+			}
+		}
+
+		rows = append(
+			rows,
+			[]string{
+				sr.filename,
+				sr.build.archKey(),
+				formatSize(sr.sizes.Raw),
+				formatSize(sr.sizes.Stripped),
+				compressed,
+				delta,
+			},
+		)
+	}
+
+	if err := writeTable(
+		cctx.StepSummary,
+		[]string{"Binary", "Target", "Size", "Stripped", "Compressed", "Previous release"},
+		rows,
+	); err != nil {
+		return err
+	}
+
+	l := cctx.Logger.WithField(toolkit.Title("size budget"))
+
+	for _, e := range exceeds {
+		if sb.action == failBudget {
+			l.Error(e)
+		} else {
+			l.Warning(e)
+		}
+	}
+
+	if len(exceeds) > 0 && sb.action == failBudget {
+		return fmt.Errorf("%d binaries exceed the %.1f%% size budget", len(exceeds), sb.threshold)
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/definitions"
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+func TestSizeBudgetExceeded(t *testing.T) {
+	for _, tt := range []struct {
+		sb        sizeBudget
+		prev, cur int64
+
+		wantGrowth   float64
+		wantExceeded bool
+	}{
+		{sb: sizeBudget{threshold: 10}, prev: 100, cur: 105, wantGrowth: 5},
+		{sb: sizeBudget{threshold: 10}, prev: 100, cur: 120, wantGrowth: 20, wantExceeded: true},
+		{sb: sizeBudget{threshold: 10}, prev: 100, cur: 50, wantGrowth: -50},
+		{sb: sizeBudget{}, prev: 100, cur: 200, wantGrowth: 100},
+		{sb: sizeBudget{threshold: 10}, cur: 200},
+	} {
+		growth, exceeded := tt.sb.exceeded(tt.prev, tt.cur)
+
+		assert.Equal(t, tt.wantGrowth, growth)
+		assert.Equal(t, tt.wantExceeded, exceeded)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 KiB", formatSize(1536))
+	assert.Equal(t, "12.0 MiB", formatSize(12*1024*1024))
+}
+
+func TestMeasure(t *testing.T) {
+	sizes, err := measure(os.Args[0])
+	require.NoError(t, err)
+
+	assert.Greater(t, sizes.Raw, int64(0))
+	assert.LessOrEqual(t, sizes.Stripped, sizes.Raw)
+	assert.Less(t, sizes.Compressed, sizes.Raw)
+}
+
+func fakeUPX(cmd executil.Command) error {
+	return os.WriteFile(cmd.Args[len(cmd.Args)-1], []byte("upx"), 0755)
+}
+
+func TestCompilePackedBinaryCached(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		cctx = testCommandContext(t)
+
+		c = config{
+			ExecutablePaths: []string{"."},
+			DistDir:         t.TempDir(),
+			OSs:             []string{"linux"},
+			Archs:           []string{"amd64"},
+			CompilerPath:    "go",
+			UPX:             true,
+		}
+
+		exc = fakeExecutorWith(execHandlers{"upx": fakeUPX})
+	)
+
+	require.NoError(t, c.NameTemplate.Parse("foo"))
+
+	bs, err := c.builds(cctx, []executable{{Path: "."}})
+	require.NoError(t, err)
+
+	compile := func() definitions.Artifact {
+		cp, err := newCompiler(c, cctx)
+		require.NoError(t, err)
+
+		cp.executor = exc
+
+		def, err := cp.compile(ctx, bs[0], cctx)
+		require.NoError(t, err)
+		require.NoError(t, cp.cache.save())
+
+		require.Len(t, cp.sizes, 1)
+		assert.Equal(
+			t,
+			binarySizes{Raw: 6, Stripped: 6, Compressed: 3, Packed: true},
+			cp.sizes[0].sizes,
+		)
+
+		return def
+	}
+
+	def := compile()
+	assert.Equal(t, def, compile())
+
+	assert.Len(t, commandsOf(exc, "build"), 1)
+
+	upx := invocationsOf(exc, "upx")
+	require.Len(t, upx, 1)
+	assert.Equal(t, []string{"-q", "--best", filepath.Join(c.DistDir, "foo")}, upx[0].Args)
+}
+
+func TestCompilePackedBinaryUPXToggled(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		cctx = testCommandContext(t)
+		exc  = fakeExecutorWith(execHandlers{"upx": fakeUPX})
+
+		c = config{
+			ExecutablePaths: []string{"."},
+			DistDir:         t.TempDir(),
+			OSs:             []string{"linux"},
+			Archs:           []string{"amd64"},
+			CompilerPath:    "go",
+			UPX:             true,
+		}
+	)
+
+	require.NoError(t, c.NameTemplate.Parse("foo"))
+
+	bs, err := c.builds(cctx, []executable{{Path: "."}})
+	require.NoError(t, err)
+
+	compile := func(upx bool) binarySizes {
+		c.UPX = upx
+
+		cp, err := newCompiler(c, cctx)
+		require.NoError(t, err)
+
+		cp.executor = exc
+
+		_, err = cp.compile(ctx, bs[0], cctx)
+		require.NoError(t, err)
+		require.NoError(t, cp.cache.save())
+
+		require.Len(t, cp.sizes, 1)
+
+		return cp.sizes[0].sizes
+	}
+
+	assert.True(t, compile(true).Packed)
+	assert.False(t, compile(false).Packed)
+
+	buf, err := os.ReadFile(filepath.Join(c.DistDir, "foo"))
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(buf))
+
+	assert.True(t, compile(true).Packed)
+
+	assert.Len(t, commandsOf(exc, "build"), 3)
+	assert.Len(t, invocationsOf(exc, "upx"), 2)
+}
+
+func TestCompilePackedBinarySBOM(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		cctx = testCommandContext(t)
+
+		c = config{
+			ExecutablePaths: []string{"."},
+			DistDir:         t.TempDir(),
+			OSs:             []string{"linux"},
+			Archs:           []string{"amd64"},
+			CompilerPath:    "go",
+			UPX:             true,
+			SBOMFormats:     []sbomFormat{cycloneDX},
+		}
+
+		exc = fakeExecutorWith(
+			execHandlers{
+				"upx": fakeUPX,
+				"build": func(cmd executil.Command) error {
+					// the test binary carries a build info
+					buf, err := os.ReadFile(os.Args[0])
+
+					if err != nil {
+						return err
+					}
+
+					return os.WriteFile(outputPath(cmd), buf, 0755)
+				},
+			},
+		)
+	)
+
+	require.NoError(t, c.NameTemplate.Parse("foo"))
+
+	bs, err := c.builds(cctx, []executable{{Path: "."}})
+	require.NoError(t, err)
+
+	cp, err := newCompiler(c, cctx)
+	require.NoError(t, err)
+
+	cp.executor = exc
+
+	a, err := cp.compile(ctx, bs[0], cctx)
+	require.NoError(t, err)
+
+	sum := sha256.Sum256([]byte("upx"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), a.Checksums.SHA256)
+
+	buf, err := os.ReadFile(filepath.Join(c.DistDir, "foo.cdx.json"))
+	require.NoError(t, err)
+
+	var doc cdxDocument
+
+	require.NoError(t, json.Unmarshal(buf, &doc))
+	assert.Equal(t, []cdxHash{{Alg: "SHA-256", Content: a.Checksums.SHA256}}, doc.Metadata.Component.Hashes)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+func writeTable(w toolkit.LineWriter, headers []string, rows [][]string) error {
+	lines := []string{
+		"| " + strings.Join(headers, " | ") + " |",
+		strings.Repeat("| --- ", len(headers)) + "|",
+	}
+
+	for _, row := range rows {
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+	}
+
+	for _, l := range append(lines, "") {
+		if err := w.WriteLine(l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
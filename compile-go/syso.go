@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"unicode/utf16"
+
+	"github.com/upfluence/errors"
+)
+
+const (
+	rtIcon      = 3
+	rtGroupIcon = 14
+	rtVersion   = 16
+
+	langEnUS    = 0x0409
+	codePageUTF = 0x04b0
+
+	imageRelAMD64Addr32NB = 0x0003
+	imageRelI386Dir32NB   = 0x0007
+	imageRelARM64Addr32NB = 0x0002
+
+	imageScnCntInitializedData = 0x00000040
+	imageScnMemRead            = 0x40000000
+
+	imageSymClassStatic = 3
+)
+
+var coffMachines = map[string]struct {
+	machine uint16
+	reloc   uint16
+}{
+	"amd64": {machine: pe.IMAGE_FILE_MACHINE_AMD64, reloc: imageRelAMD64Addr32NB},
+	"386":   {machine: pe.IMAGE_FILE_MACHINE_I386, reloc: imageRelI386Dir32NB},
+	"arm64": {machine: pe.IMAGE_FILE_MACHINE_ARM64, reloc: imageRelARM64Addr32NB},
+}
+
+type resourceDirectory struct {
+	Characteristics      uint32
+	TimeDateStamp        uint32
+	MajorVersion         uint16
+	MinorVersion         uint16
+	NumberOfNamedEntries uint16
+	NumberOfIDEntries    uint16
+}
+
+type resourceDirectoryEntry struct {
+	ID           uint32
+	OffsetToData uint32
+}
+
+type resourceDataEntry struct {
+	OffsetToData uint32
+	Size         uint32
+	CodePage     uint32
+	Reserved     uint32
+}
+
+type resource struct {
+	typ  uint32
+	id   uint32
+	data []byte
+}
+
+func align(n, a int) int {
+	return (n + a - 1) &^ (a - 1)
+}
+
+func pad(buf *bytes.Buffer, a int) {
+	buf.Write(make([]byte, align(buf.Len(), a)-buf.Len()))
+}
+
+// encodeResources lays out the .rsrc section: the type, id and language
+// directory levels followed by the data entries and the data itself. It
+// returns the offsets of the data entries fields which have to be relocated.
+func encodeResources(rs []resource) ([]byte, []uint32) {
+	slices.SortFunc(rs, func(a, b resource) int {
+		if a.typ != b.typ {
+			return int(a.typ) - int(b.typ)
+		}
+
+		return int(a.id) - int(b.id)
+	})
+
+	var (
+		types []uint32
+		ids   = make(map[uint32][]resource)
+	)
+
+	for _, r := range rs {
+		if _, ok := ids[r.typ]; !ok {
+			types = append(types, r.typ)
+		}
+
+		ids[r.typ] = append(ids[r.typ], r)
+	}
+
+	const (
+		dirSize   = 16
+		entrySize = 8
+		dataSize  = 16
+	)
+
+	var (
+		typeDirs  = dirSize + entrySize*len(types)
+		idDirs    = typeDirs
+		langDirs  int
+		dataEntry int
+	)
+
+	for _, t := range types {
+		idDirs += dirSize + entrySize*len(ids[t])
+	}
+
+	langDirs = idDirs + len(rs)*(dirSize+entrySize)
+	dataEntry = langDirs + len(rs)*dataSize
+
+	var (
+		buf    bytes.Buffer
+		relocs []uint32
+
+		writeDir = func(n int) {
+			binary.Write(&buf, binary.LittleEndian, resourceDirectory{NumberOfIDEntries: uint16(n)})
+		}
+		writeEntry = func(id uint32, off int, dir bool) {
+			e := resourceDirectoryEntry{ID: id, OffsetToData: uint32(off)}
+
+			if dir {
+				e.OffsetToData |= 0x80000000
+			}
+
+			binary.Write(&buf, binary.LittleEndian, e)
+		}
+	)
+
+	writeDir(len(types))
+
+	off := typeDirs
+
+	for _, t := range types {
+		writeEntry(t, off, true)
+		off += dirSize + entrySize*len(ids[t])
+	}
+
+	i := 0
+
+	for _, t := range types {
+		writeDir(len(ids[t]))
+
+		for _, r := range ids[t] {
+			writeEntry(r.id, idDirs+i*(dirSize+entrySize), true)
+			i++
+		}
+	}
+
+	for i := range rs {
+		writeDir(1)
+		writeEntry(langEnUS, langDirs+i*dataSize, false)
+	}
+
+	dataOff := align(dataEntry, 8)
+
+	for _, t := range types {
+		for _, r := range ids[t] {
+			relocs = append(relocs, uint32(buf.Len()))
+
+			binary.Write(
+				&buf,
+				binary.LittleEndian,
+				resourceDataEntry{OffsetToData: uint32(dataOff), Size: uint32(len(r.data))},
+			)
+
+			dataOff = align(dataOff+len(r.data), 8)
+		}
+	}
+
+	for _, t := range types {
+		for _, r := range ids[t] {
+			pad(&buf, 8)
+			buf.Write(r.data)
+		}
+	}
+
+	return buf.Bytes(), relocs
+}
+
+// encodeSyso wraps the resources into a COFF object the go linker merges
+// into the .rsrc section of the PE binary.
+func encodeSyso(arch string, rs []resource) ([]byte, error) {
+	m, ok := coffMachines[arch]
+
+	if !ok {
+		return nil, fmt.Errorf("windows resources are not supported for %q", arch)
+	}
+
+	data, relocs := encodeResources(rs)
+
+	var (
+		buf bytes.Buffer
+
+		dataPtr   = 20 + 40
+		relocPtr  = dataPtr + len(data)
+		symbolPtr = relocPtr + 10*len(relocs)
+	)
+
+	binary.Write(
+		&buf,
+		binary.LittleEndian,
+		pe.FileHeader{
+			Machine:              m.machine,
+			NumberOfSections:     1,
+			PointerToSymbolTable: uint32(symbolPtr),
+			NumberOfSymbols:      1,
+		},
+	)
+
+	if len(relocs) > 0xffff {
+		return nil, errors.New("too many windows resources")
+	}
+
+	sh := pe.SectionHeader32{
+		SizeOfRawData:        uint32(len(data)),
+		PointerToRawData:     uint32(dataPtr),
+		PointerToRelocations: uint32(relocPtr),
+		NumberOfRelocations:  uint16(len(relocs)),
+		Characteristics:      imageScnCntInitializedData | imageScnMemRead,
+	}
+
+	copy(sh.Name[:], ".rsrc")
+	binary.Write(&buf, binary.LittleEndian, sh)
+
+	buf.Write(data)
+
+	for _, r := range relocs {
+		binary.Write(&buf, binary.LittleEndian, pe.Reloc{VirtualAddress: r, Type: m.reloc})
+	}
+
+	sym := pe.COFFSymbol{SectionNumber: 1, StorageClass: imageSymClassStatic}
+	copy(sym.Name[:], ".rsrc")
+	binary.Write(&buf, binary.LittleEndian, sym)
+
+	// empty string table, only holding its own size
+	binary.Write(&buf, binary.LittleEndian, uint32(4))
+
+	return buf.Bytes(), nil
+}
+
+func utf16z(v string) []byte {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.LittleEndian, append(utf16.Encode([]rune(v)), 0))
+
+	return buf.Bytes()
+}
+
+// versionNode is the generic layout shared by every block of a
+// VS_VERSIONINFO resource.
+type versionNode struct {
+	key      string
+	value    []byte
+	text     bool
+	children []versionNode
+}
+
+func (vn versionNode) encode() []byte {
+	var buf bytes.Buffer
+
+	buf.Write(make([]byte, 6))
+	buf.Write(utf16z(vn.key))
+	pad(&buf, 4)
+	buf.Write(vn.value)
+
+	for _, c := range vn.children {
+		pad(&buf, 4)
+		buf.Write(c.encode())
+	}
+
+	out := buf.Bytes()
+
+	var valueLength, typ uint16
+
+	valueLength = uint16(len(vn.value))
+
+	if vn.text {
+		valueLength /= 2
+		typ = 1
+	}
+
+	binary.LittleEndian.PutUint16(out[0:], uint16(len(out)))
+	binary.LittleEndian.PutUint16(out[2:], valueLength)
+	binary.LittleEndian.PutUint16(out[4:], typ)
+
+	return out
+}
+
+type fixedFileInfo struct {
+	Signature        uint32
+	StrucVersion     uint32
+	FileVersionMS    uint32
+	FileVersionLS    uint32
+	ProductVersionMS uint32
+	ProductVersionLS uint32
+	FileFlagsMask    uint32
+	FileFlags        uint32
+	FileOS           uint32
+	FileType         uint32
+	FileSubtype      uint32
+	FileDateMS       uint32
+	FileDateLS       uint32
+}
+
+type versionInfo struct {
+	version [4]uint16
+	strings [][2]string
+}
+
+func (vi versionInfo) encode() []byte {
+	var (
+		buf bytes.Buffer
+
+		ms = uint32(vi.version[0])<<16 | uint32(vi.version[1])
+		ls = uint32(vi.version[2])<<16 | uint32(vi.version[3])
+
+		table = versionNode{key: fmt.Sprintf("%04x%04x", langEnUS, codePageUTF), text: true}
+	)
+
+	binary.Write(
+		&buf,
+		binary.LittleEndian,
+		fixedFileInfo{
+			Signature:        0xfeef04bd,
+			StrucVersion:     0x00010000,
+			FileVersionMS:    ms,
+			FileVersionLS:    ls,
+			ProductVersionMS: ms,
+			ProductVersionLS: ls,
+			FileFlagsMask:    0x3f,
+			FileOS:           0x00040004,
+			FileType:         1,
+		},
+	)
+
+	for _, kv := range vi.strings {
+		table.children = append(
+			table.children,
+			versionNode{key: kv[0], value: utf16z(kv[1]), text: true},
+		)
+	}
+
+	var translation bytes.Buffer
+
+	binary.Write(&translation, binary.LittleEndian, [2]uint16{langEnUS, codePageUTF})
+
+	return versionNode{
+		key:   "VS_VERSION_INFO",
+		value: buf.Bytes(),
+		children: []versionNode{
+			{key: "StringFileInfo", text: true, children: []versionNode{table}},
+			{
+				key:  "VarFileInfo",
+				text: true,
+				children: []versionNode{
+					{key: "Translation", value: translation.Bytes()},
+				},
+			},
+		},
+	}.encode()
+}
+
+type iconDir struct {
+	Reserved uint16
+	Type     uint16
+	Count    uint16
+}
+
+type iconDirEntry struct {
+	Width      uint8
+	Height     uint8
+	ColorCount uint8
+	Reserved   uint8
+	Planes     uint16
+	BitCount   uint16
+	BytesInRes uint32
+	Offset     uint32
+}
+
+type groupIconDirEntry struct {
+	Width      uint8
+	Height     uint8
+	ColorCount uint8
+	Reserved   uint8
+	Planes     uint16
+	BitCount   uint16
+	BytesInRes uint32
+	ID         uint16
+}
+
+// iconResources splits an .ico file into the RT_ICON images and the
+// RT_GROUP_ICON directory referencing them.
+func iconResources(ico []byte) ([]resource, error) {
+	var (
+		dir iconDir
+
+		r = bytes.NewReader(ico)
+	)
+
+	if err := binary.Read(r, binary.LittleEndian, &dir); err != nil || dir.Type != 1 {
+		return nil, errors.New("invalid ico file")
+	}
+
+	var (
+		rs    []resource
+		group bytes.Buffer
+	)
+
+	binary.Write(&group, binary.LittleEndian, dir)
+
+	for i := 0; i < int(dir.Count); i++ {
+		var e iconDirEntry
+
+		if err := binary.Read(r, binary.LittleEndian, &e); err != nil {
+			return nil, errors.Wrap(err, "invalid ico file")
+		}
+
+		end := uint64(e.Offset) + uint64(e.BytesInRes)
+
+		if end > uint64(len(ico)) {
+			return nil, errors.New("invalid ico file: image out of bounds")
+		}
+
+		id := uint16(i + 1)
+
+		rs = append(rs, resource{typ: rtIcon, id: uint32(id), data: ico[e.Offset:end]})
+
+		binary.Write(
+			&group,
+			binary.LittleEndian,
+			groupIconDirEntry{
+				Width:      e.Width,
+				Height:     e.Height,
+				ColorCount: e.ColorCount,
+				Planes:     e.Planes,
+				BitCount:   e.BitCount,
+				BytesInRes: e.BytesInRes,
+				ID:         id,
+			},
+		)
+	}
+
+	return append(rs, resource{typ: rtGroupIcon, id: 1, data: group.Bytes()}), nil
+}
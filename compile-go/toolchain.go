@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+)
+
+const wildcardTarget = "*"
+
+type cToolchainPreset int
+
+const (
+	defaultPreset cToolchainPreset = iota
+	zigPreset
+)
+
+func (p *cToolchainPreset) Parse(v string) error {
+	switch v {
+	case "zig":
+		*p = zigPreset
+	case "default", "":
+		*p = defaultPreset
+	default:
+		return fmt.Errorf("Invalid c-toolchain %q", v)
+	}
+
+	return nil
+}
+
+var zigTargets = map[string]string{
+	"linux/amd64":   "x86_64-linux-musl",
+	"linux/arm64":   "aarch64-linux-musl",
+	"linux/386":     "x86-linux-musl",
+	"linux/arm":     "arm-linux-musleabihf",
+	"darwin/amd64":  "x86_64-macos",
+	"darwin/arm64":  "aarch64-macos",
+	"windows/amd64": "x86_64-windows-gnu",
+	"windows/arm64": "aarch64-windows-gnu",
+	"windows/386":   "x86-windows-gnu",
+}
+
+func (p cToolchainPreset) toolchain(target string) (cToolchain, error) {
+	switch p {
+	case zigPreset:
+		t, ok := zigTargets[target]
+
+		if !ok {
+			return cToolchain{}, fmt.Errorf("no zig target known for %q", target)
+		}
+
+		return cToolchain{
+			CC:  "zig cc -target " + t,
+			CXX: "zig c++ -target " + t,
+		}, nil
+	}
+
+	return cToolchain{}, nil
+}
+
+type cToolchain struct {
+	CC      string
+	CXX     string
+	CFlags  string
+	LDFlags string
+
+	Static bool
+}
+
+func (ct cToolchain) env() map[string]string {
+	env := make(map[string]string)
+
+	for k, v := range map[string]string{
+		"CC":          ct.CC,
+		"CXX":         ct.CXX,
+		"CGO_CFLAGS":  ct.CFlags,
+		"CGO_LDFLAGS": ct.LDFlags,
+	} {
+		if v != "" {
+			env[k] = v
+		}
+	}
+
+	return env
+}
+
+func lookupTarget[T any](vs map[string]T, target string) (T, bool) {
+	if v, ok := vs[target]; ok {
+		return v, true
+	}
+
+	v, ok := vs[wildcardTarget]
+
+	return v, ok
+}
+
+func (c config) cToolchain(target string) (cToolchain, error) {
+	var ct cToolchain
+
+	if p, ok := lookupTarget(c.CToolchains, target); ok {
+		var err error
+
+		if ct, err = p.toolchain(target); err != nil {
+			return ct, err
+		}
+	}
+
+	for _, kv := range []struct {
+		vs map[string]string
+		v  *string
+	}{
+		{vs: c.CC, v: &ct.CC},
+		{vs: c.CXX, v: &ct.CXX},
+		{vs: c.CGoCFlags, v: &ct.CFlags},
+		{vs: c.CGoLDFlags, v: &ct.LDFlags},
+	} {
+		if v, ok := lookupTarget(kv.vs, target); ok {
+			*kv.v = v
+		}
+	}
+
+	ct.Static = true
+
+	for _, t := range c.DynamicLinkTargets {
+		if t == target || t == wildcardTarget {
+			ct.Static = false
+		}
+	}
+
+	return ct, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/definitions"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+const (
+	universalArch = "all"
+
+	// fat slices are aligned on 16KiB boundaries, which satisfies the page
+	// size of every architecture supported by darwin (this is what lipo
+	// picks for arm64).
+	fatAlign = 14
+)
+
+var darwinArchs = []string{"amd64", "arm64"}
+
+type fatHeader struct {
+	Magic uint32
+	NArch uint32
+}
+
+type thinFile struct {
+	cpu    macho.Cpu
+	subCpu uint32
+	buf    []byte
+}
+
+func readThinFile(fname string) (thinFile, error) {
+	buf, err := os.ReadFile(fname)
+
+	if err != nil {
+		return thinFile{}, errors.Wrapf(err, "cant read %q", fname)
+	}
+
+	f, err := macho.NewFile(bytes.NewReader(buf))
+
+	if err != nil {
+		return thinFile{}, errors.Wrapf(err, "%q is not a thin Mach-O file", fname)
+	}
+
+	return thinFile{cpu: f.Cpu, subCpu: f.SubCpu, buf: buf}, nil
+}
+
+func mergeMachO(w io.Writer, fnames []string) error {
+	var tfs []thinFile
+
+	for _, fname := range fnames {
+		tf, err := readThinFile(fname)
+
+		if err != nil {
+			return err
+		}
+
+		for _, otf := range tfs {
+			if otf.cpu == tf.cpu {
+				return fmt.Errorf("cpu %v is present more than once", tf.cpu)
+			}
+		}
+
+		tfs = append(tfs, tf)
+	}
+
+	sort.Slice(tfs, func(i, j int) bool { return tfs[i].cpu < tfs[j].cpu })
+
+	var (
+		align   = uint64(1) << fatAlign
+		offset  = uint64(8 + 20*len(tfs))
+		headers = make([]macho.FatArchHeader, len(tfs))
+	)
+
+	for i, tf := range tfs {
+		offset = (offset + align - 1) &^ (align - 1)
+
+		if offset+uint64(len(tf.buf)) > 1<<32-1 {
+			return errors.New("universal binary exceeds 4GiB")
+		}
+
+		headers[i] = macho.FatArchHeader{
+			Cpu:    tf.cpu,
+			SubCpu: tf.subCpu,
+			Offset: uint32(offset),
+			Size:   uint32(len(tf.buf)),
+			Align:  fatAlign,
+		}
+
+		offset += uint64(len(tf.buf))
+	}
+
+	var buf bytes.Buffer
+
+	binary.Write(
+		&buf,
+		binary.BigEndian,
+		fatHeader{Magic: macho.MagicFat, NArch: uint32(len(tfs))},
+	)
+
+	for _, h := range headers {
+		binary.Write(&buf, binary.BigEndian, h)
+	}
+
+	for i, tf := range tfs {
+		buf.Write(make([]byte, int(headers[i].Offset)-buf.Len()))
+		buf.Write(tf.buf)
+	}
+
+	_, err := buf.WriteTo(w)
+
+	return err
+}
+
+func universalBuilds(bs []build) []build {
+	var (
+		ubs []build
+
+		seen = make(map[string]struct{})
+	)
+
+	for _, b := range bs {
+		if b.OS != "darwin" {
+			continue
+		}
+
+		if _, ok := seen[b.Path]; ok {
+			continue
+		}
+
+		seen[b.Path] = struct{}{}
+
+		ubs = append(
+			ubs,
+			build{
+				Path:    b.Path,
+				Module:  b.Module,
+				Version: b.Version,
+				OS:      b.OS,
+				Arch:    universalArch,
+				links:   b.links,
+			},
+		)
+	}
+
+	return ubs
+}
+
+// universal merges the darwin binaries of b, the universal binary is then
+// verified, described and measured as the binaries it is made of.
+func (c *compiler) universal(ctx context.Context, b build, defs definitions.Definitions, cctx toolkit.CommandContext) (definitions.Artifact, bool, error) {
+	var fnames []string
+
+	for _, arch := range darwinArchs {
+		a, ok := defs.Lookup(b.Name(), fmt.Sprintf("%s/%s", b.OS, arch))
+
+		if !ok {
+			cctx.Logger.Warningf(
+				"Skipping universal binary of %s: no %s/%s build",
+				b.Name(),
+				b.OS,
+				arch,
+			)
+
+			return definitions.Artifact{}, false, nil
+		}
+
+		fnames = append(fnames, filepath.Join(c.distDir, a.Path))
+	}
+
+	t, err := c.nt.render(b)
+
+	if err != nil {
+		return definitions.Artifact{}, false, err
+	}
+
+	var buf bytes.Buffer
+
+	if err := mergeMachO(&buf, fnames); err != nil {
+		return definitions.Artifact{}, false, errors.Wrapf(err, "cant merge universal binary of %s", b.Name())
+	}
+
+	filename := filepath.Join(c.distDir, t)
+
+	if err := os.WriteFile(filename, buf.Bytes(), 0755); err != nil {
+		return definitions.Artifact{}, false, errors.Wrapf(err, "cant write %q", filename)
+	}
+
+	sum, err := hashFile(filename)
+
+	if err != nil {
+		return definitions.Artifact{}, false, err
+	}
+
+	cctx.Logger.Noticef("Finished merging %s (checksum: %s)", filename, sum)
+
+	if c.verifyBinaries {
+		if err := c.verify(ctx, b, t, cctx); err != nil {
+			return definitions.Artifact{}, false, err
+		}
+	}
+
+	bi, err := c.buildInfo(t)
+
+	if err != nil {
+		return definitions.Artifact{}, false, err
+	}
+
+	sboms, err := c.writeSBOMs(b, t, sum, bi)
+
+	if err != nil {
+		return definitions.Artifact{}, false, err
+	}
+
+	sizes, err := measure(filename)
+
+	if err != nil {
+		return definitions.Artifact{}, false, err
+	}
+
+	c.sizes = append(c.sizes, sizeReport{build: b, filename: t, sizes: sizes})
+
+	a, err := c.artifact(b, definitions.UniversalBinary, t, sum, sboms)
+
+	return a, err == nil, err
+}
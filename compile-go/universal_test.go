@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeThinMachO(t testing.TB, dir string, cpu macho.Cpu) string {
+	var buf bytes.Buffer
+
+	binary.Write(
+		&buf,
+		binary.LittleEndian,
+		struct {
+			macho.FileHeader
+			Reserved uint32
+		}{
+			FileHeader: macho.FileHeader{
+				Magic: macho.Magic64,
+				Cpu:   cpu,
+				Type:  macho.TypeExec,
+			},
+		},
+	)
+
+	fname := filepath.Join(dir, cpu.String())
+	require.NoError(t, os.WriteFile(fname, buf.Bytes(), 0755))
+
+	return fname
+}
+
+func TestMergeMachO(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+
+	err := mergeMachO(
+		&buf,
+		[]string{
+			writeThinMachO(t, dir, macho.CpuArm64),
+			writeThinMachO(t, dir, macho.CpuAmd64),
+		},
+	)
+	require.NoError(t, err)
+
+	ff, err := macho.NewFatFile(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	require.Len(t, ff.Arches, 2)
+
+	for i, cpu := range []macho.Cpu{macho.CpuAmd64, macho.CpuArm64} {
+		assert.Equal(t, cpu, ff.Arches[i].Cpu)
+		assert.Equal(t, uint32(0), ff.Arches[i].Offset%(1<<fatAlign))
+		assert.Equal(t, macho.TypeExec, ff.Arches[i].Type)
+	}
+}
+
+func TestMergeMachODuplicatedCpu(t *testing.T) {
+	dir := t.TempDir()
+	fname := writeThinMachO(t, dir, macho.CpuArm64)
+
+	assert.Error(t, mergeMachO(&bytes.Buffer{}, []string{fname, fname}))
+}
+
+func TestUniversalBuilds(t *testing.T) {
+	assert.Equal(
+		t,
+		[]build{{Path: "cmd/foo", Version: "v1.0.0", OS: "darwin", Arch: "all"}},
+		universalBuilds(
+			[]build{
+				{Path: "cmd/foo", Version: "v1.0.0", OS: "linux", Arch: "amd64"},
+				{Path: "cmd/foo", Version: "v1.0.0", OS: "darwin", Arch: "amd64"},
+				{Path: "cmd/foo", Version: "v1.0.0", OS: "darwin", Arch: "arm64"},
+			},
+		),
+	)
+}
+
+func TestCheckPlatformUniversal(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		b   = build{OS: "darwin", Arch: universalArch}
+
+		amd64 = writeThinMachO(t, dir, macho.CpuAmd64)
+		arm64 = writeThinMachO(t, dir, macho.CpuArm64)
+	)
+
+	for _, tt := range []struct {
+		fnames  []string
+		wantErr bool
+	}{
+		{fnames: []string{amd64, arm64}},
+		{fnames: []string{arm64}, wantErr: true},
+	} {
+		var buf bytes.Buffer
+
+		require.NoError(t, mergeMachO(&buf, tt.fnames))
+
+		fname := filepath.Join(dir, "universal")
+		require.NoError(t, os.WriteFile(fname, buf.Bytes(), 0755))
+
+		if err := checkPlatform(b, fname); tt.wantErr {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		assert.Zero(t, debugSize(fname))
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/executil"
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+type binaryFormat string
+
+const (
+	elfFormat   binaryFormat = "ELF"
+	machoFormat binaryFormat = "Mach-O"
+	peFormat    binaryFormat = "PE"
+)
+
+func expectedFormat(goos string) binaryFormat {
+	switch goos {
+	case "darwin", "ios":
+		return machoFormat
+	case "windows":
+		return peFormat
+	}
+
+	return elfFormat
+}
+
+var (
+	elfArchs = map[elf.Machine]string{
+		elf.EM_X86_64:  "amd64",
+		elf.EM_AARCH64: "arm64",
+		elf.EM_386:     "386",
+		elf.EM_ARM:     "arm",
+		elf.EM_RISCV:   "riscv64",
+		elf.EM_S390:    "s390x",
+	}
+
+	machoArchs = map[macho.Cpu]string{
+		macho.CpuAmd64: "amd64",
+		macho.CpuArm64: "arm64",
+		macho.Cpu386:   "386",
+	}
+
+	peArchs = map[uint16]string{
+		pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+		pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+		pe.IMAGE_FILE_MACHINE_I386:  "386",
+		pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+	}
+)
+
+func elfArch(f *elf.File) string {
+	if f.Machine == elf.EM_PPC64 {
+		if f.ByteOrder == binary.LittleEndian {
+			return "ppc64le"
+		}
+
+		return "ppc64"
+	}
+
+	return elfArchs[f.Machine]
+}
+
+func binaryPlatform(fname string) (binaryFormat, string, error) {
+	if f, err := elf.Open(fname); err == nil {
+		defer f.Close()
+		return elfFormat, elfArch(f), nil
+	}
+
+	if f, err := macho.Open(fname); err == nil {
+		defer f.Close()
+		return machoFormat, machoArchs[f.Cpu], nil
+	}
+
+	if f, err := pe.Open(fname); err == nil {
+		defer f.Close()
+		return peFormat, peArchs[f.Machine], nil
+	}
+
+	if f, err := macho.OpenFat(fname); err == nil {
+		defer f.Close()
+		return machoFormat, fatArch(f), nil
+	}
+
+	return "", "", fmt.Errorf("%q is not an ELF, Mach-O nor PE binary", fname)
+}
+
+// fatArch is universalArch when the universal binary holds a slice for
+// every darwin arch, the list of its archs otherwise.
+func fatArch(f *macho.FatFile) string {
+	archs := make([]string, len(f.Arches))
+
+	for i, a := range f.Arches {
+		archs[i] = machoArchs[a.Cpu]
+	}
+
+	slices.Sort(archs)
+
+	if slices.Equal(archs, darwinArchs) {
+		return universalArch
+	}
+
+	return strings.Join(archs, ",")
+}
+
+func checkPlatform(b build, fname string) error {
+	format, arch, err := binaryPlatform(fname)
+
+	if err != nil {
+		return err
+	}
+
+	if want := expectedFormat(b.OS); format != want {
+		return fmt.Errorf("expected a %s binary for %s, got %s", want, b.OS, format)
+	}
+
+	if arch != b.Arch {
+		return fmt.Errorf("expected a %s binary, got %q", b.Arch, arch)
+	}
+
+	return nil
+}
+
+func buildSetting(bi *buildinfo.BuildInfo, k string) string {
+	for _, s := range bi.Settings {
+		if s.Key == k {
+			return s.Value
+		}
+	}
+
+	return ""
+}
+
+// checkLinksLanded makes sure every -X flag reached the linker, through the
+// flags recorded in the build info, and returns the links whose value can
+// not be found in the binary, which happens when the variable is dead code.
+func checkLinksLanded(fname string, links map[string]string) ([]string, error) {
+	bi, err := buildinfo.ReadFile(fname)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cant read build info")
+	}
+
+	buf, err := os.ReadFile(fname)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ldFlags = buildSetting(bi, "-ldflags")
+
+		missing, absent []string
+	)
+
+	for k, v := range links {
+		if !strings.Contains(ldFlags, fmt.Sprintf("%s=%s", k, v)) {
+			missing = append(missing, k)
+			continue
+		}
+
+		if v != "" && !bytes.Contains(buf, []byte(v)) {
+			absent = append(absent, k)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("links not recorded in the build info: %s", strings.Join(missing, ", "))
+	}
+
+	return absent, nil
+}
+
+// commandTemplate is a command rendered as a Go template, split on spaces.
+type commandTemplate struct {
+	t *template.Template
+}
+
+func (ct *commandTemplate) Parse(v string) error {
+	if v == "" {
+		ct.t = nil
+		return nil
+	}
+
+	var err error
+
+	ct.t, err = template.New("").Option("missingkey=error").Parse(v)
+
+	return err
+}
+
+func (ct commandTemplate) render(data any) ([]string, error) {
+	var buf bytes.Buffer
+
+	if err := ct.t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	args := strings.Fields(buf.String())
+
+	if len(args) == 0 {
+		return nil, errors.New("command renders to an empty command")
+	}
+
+	return args, nil
+}
+
+type smokeContext struct {
+	build
+
+	Path string
+}
+
+func isNative(b build) bool {
+	return b.OS == runtime.GOOS && (b.Arch == runtime.GOARCH || b.Arch == universalArch)
+}
+
+func (c *compiler) smokeTest(ctx context.Context, b build, fname string) error {
+	if !isNative(b) {
+		return nil
+	}
+
+	p, err := filepath.Abs(fname)
+
+	if err != nil {
+		return err
+	}
+
+	args, err := c.smokeCommand.render(smokeContext{build: b, Path: p})
+
+	if err != nil {
+		return errors.Wrap(err, "cant render smoke command")
+	}
+
+	var out bytes.Buffer
+
+	if err := c.executor.Exec(
+		ctx,
+		executil.Command{Cmd: args[0], Args: args[1:], Stdout: &out, Stderr: &out},
+	); err != nil {
+		return errors.Wrapf(err, "smoke command %q failed: %s", strings.Join(args, " "), out.String())
+	}
+
+	return nil
+}
+
+func (c *compiler) verify(ctx context.Context, b build, fname string, cctx toolkit.CommandContext) error {
+	var (
+		errs []error
+
+		filename = filepath.Join(c.distDir, fname)
+		l        = cctx.Logger.WithField(toolkit.Title("verify " + fname))
+	)
+
+	if err := checkPlatform(b, filename); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(b.links) > 0 {
+		absent, err := checkLinksLanded(filename, b.links)
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		for _, k := range absent {
+			l.Warningf("value linked to %s not found in the binary, is the variable used?", k)
+		}
+	}
+
+	if c.smokeCommand.t != nil {
+		if err := c.smokeTest(ctx, b, filename); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, err := range errs {
+		l.Errorf("%s: %v", b.archKey(), err)
+	}
+
+	if len(errs) > 0 {
+		return errors.WrapErrors(errs)
+	}
+
+	l.Noticef("%s (%s) verified", fname, b.archKey())
+
+	return nil
+}
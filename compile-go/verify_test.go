@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+func TestCheckPlatform(t *testing.T) {
+	native := build{OS: runtime.GOOS, Arch: runtime.GOARCH}
+
+	assert.NoError(t, checkPlatform(native, os.Args[0]))
+
+	foreign := native
+	foreign.Arch = "mips64"
+	assert.Error(t, checkPlatform(foreign, os.Args[0]))
+
+	foreign = native
+	foreign.OS = "windows"
+
+	if native.OS == "windows" {
+		foreign.OS = "linux"
+	}
+
+	assert.Error(t, checkPlatform(foreign, os.Args[0]))
+}
+
+func TestCheckLinksLanded(t *testing.T) {
+	_, err := checkLinksLanded(os.Args[0], map[string]string{"main.Version": "v1.0.0"})
+
+	assert.EqualError(t, err, "links not recorded in the build info: main.Version")
+}
+
+func TestVerify(t *testing.T) {
+	cp := compiler{
+		distDir:  filepath.Dir(os.Args[0]),
+		executor: executil.StdExecutor{},
+	}
+
+	require.NoError(t, cp.smokeCommand.Parse("{{ .Path }} -test.run ^$"))
+
+	b := build{Path: "foo", OS: runtime.GOOS, Arch: runtime.GOARCH}
+	cctx := testCommandContext(t)
+
+	assert.NoError(t, cp.verify(context.Background(), b, filepath.Base(os.Args[0]), cctx))
+
+	require.NoError(t, cp.smokeCommand.Parse("{{ .Path }} -unknown-flag"))
+	assert.Error(t, cp.verify(context.Background(), b, filepath.Base(os.Args[0]), cctx))
+}
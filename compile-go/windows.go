@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	gobuild "go/build"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/upfluence/errors"
+)
+
+type windowsResources struct {
+	enabled bool
+
+	productName string
+	companyName string
+	icon        []byte
+}
+
+func (c config) windowsResources() (windowsResources, error) {
+	wr := windowsResources{
+		enabled:     c.WindowsResources,
+		productName: c.WindowsProductName,
+		companyName: c.WindowsCompanyName,
+	}
+
+	if !wr.enabled || c.WindowsIcon == "" {
+		return wr, nil
+	}
+
+	buf, err := os.ReadFile(c.WindowsIcon)
+
+	if err != nil {
+		return wr, errors.Wrapf(err, "cant read windows icon %q", c.WindowsIcon)
+	}
+
+	if _, err := iconResources(buf); err != nil {
+		return wr, errors.Wrapf(err, "invalid windows icon %q", c.WindowsIcon)
+	}
+
+	wr.icon = buf
+
+	return wr, nil
+}
+
+// fileVersion converts the release version in the 4 numbers stored in the
+// fixed part of the version resource, the build number is left to 0.
+func fileVersion(v string) [4]uint16 {
+	sv, err := semver.NewVersion(strings.ReplaceAll(v, "_", "+"))
+
+	if err != nil {
+		return [4]uint16{}
+	}
+
+	return [4]uint16{uint16(sv.Major()), uint16(sv.Minor()), uint16(sv.Patch())}
+}
+
+func (wr windowsResources) resources(b build, fname string) ([]resource, error) {
+	var (
+		product = wr.productName
+		version = b.Version
+	)
+
+	if product == "" {
+		product = b.Name()
+	}
+
+	if version == "" {
+		version = "0.0.0"
+	}
+
+	vi := versionInfo{
+		version: fileVersion(version),
+		strings: [][2]string{
+			{"CompanyName", wr.companyName},
+			{"FileDescription", product},
+			{"FileVersion", version},
+			{"InternalName", b.Name()},
+			{"OriginalFilename", fname},
+			{"ProductName", product},
+			{"ProductVersion", version},
+		},
+	}
+
+	rs := []resource{{typ: rtVersion, id: 1, data: vi.encode()}}
+
+	if len(wr.icon) == 0 {
+		return rs, nil
+	}
+
+	irs, err := iconResources(wr.icon)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rs, irs...), nil
+}
+
+func sysoFilename(b build) string {
+	return filepath.Join(b.Path, fmt.Sprintf("zz_compile_go_windows_%s.syso", b.Arch))
+}
+
+// checkSysoFiles fails when the package already links a .syso file for the
+// target, it would clash with the generated resources. A generated file left
+// over by an interrupted build is overwritten.
+func checkSysoFiles(b build, sf string) error {
+	fnames, err := filepath.Glob(filepath.Join(b.Path, "*.syso"))
+
+	if err != nil {
+		return err
+	}
+
+	ctxt := gobuild.Default
+	ctxt.GOOS = b.OS
+	ctxt.GOARCH = b.Arch
+
+	for _, fname := range fnames {
+		if fname == sf {
+			continue
+		}
+
+		if ok, err := ctxt.MatchFile(b.Path, filepath.Base(fname)); err == nil && ok {
+			return fmt.Errorf("%q clashes with the windows resources, disable windows-resources to link it", fname)
+		}
+	}
+
+	return nil
+}
+
+// writeSyso drops the resources of a windows build next to its main package,
+// the go tool picks .syso files up for the matching GOARCH. The returned
+// function removes the file once the build is done.
+func (wr windowsResources) writeSyso(b build, fname string) (func(), error) {
+	if !wr.enabled || b.OS != "windows" {
+		return func() {}, nil
+	}
+
+	rs, err := wr.resources(b, fname)
+
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := encodeSyso(b.Arch, rs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sf := sysoFilename(b)
+
+	if err := checkSysoFiles(b, sf); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(sf, buf, 0644); err != nil {
+		return nil, errors.Wrapf(err, "cant write %q", sf)
+	}
+
+	return func() { os.Remove(sf) }, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+func TestNameTemplateExt(t *testing.T) {
+	for _, tt := range []struct {
+		tmpl string
+		b    build
+
+		want string
+	}{
+		{b: build{Path: "cmd/foo", OS: "linux"}, want: "foo"},
+		{b: build{Path: "cmd/foo", OS: "windows"}, want: "foo.exe"},
+		{tmpl: "{{ .Name }}-{{ .OS }}", b: build{Path: "cmd/foo", OS: "windows"}, want: "foo-windows.exe"},
+		{tmpl: "{{ .Name }}{{ .Ext }}", b: build{Path: "cmd/foo", OS: "windows"}, want: "foo.exe"},
+		{tmpl: "{{ .Name }}{{ .Ext }}", b: build{Path: "cmd/foo", OS: "darwin"}, want: "foo"},
+	} {
+		var nt nameTemplate
+
+		if tt.tmpl != "" {
+			require.NoError(t, nt.Parse(tt.tmpl))
+		}
+
+		name, err := nt.render(tt.b)
+		require.NoError(t, err)
+
+		assert.Equal(t, tt.want, name)
+	}
+}
+
+func TestCheckCollisions(t *testing.T) {
+	var nt nameTemplate
+
+	bs := []build{
+		{Path: "cmd/foo", OS: "linux", Arch: "amd64"},
+		{Path: "cmd/foo", OS: "windows", Arch: "amd64"},
+	}
+
+	assert.NoError(t, nt.checkCollisions(bs))
+
+	bs = append(bs, build{Path: "cmd/foo", OS: "linux", Arch: "arm64"})
+
+	err := nt.checkCollisions(bs)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "foo (cmd/foo@linux/amd64, cmd/foo@linux/arm64)")
+
+	require.NoError(t, nt.Parse("{{ .Name }}-{{ .OS }}-{{ .Arch }}"))
+	assert.NoError(t, nt.checkCollisions(bs))
+}
+
+func writeTestIcon(t testing.TB) string {
+	var (
+		buf   bytes.Buffer
+		image = []byte("fake png image")
+	)
+
+	binary.Write(&buf, binary.LittleEndian, iconDir{Type: 1, Count: 1})
+	binary.Write(
+		&buf,
+		binary.LittleEndian,
+		iconDirEntry{
+			Width:      16,
+			Height:     16,
+			Planes:     1,
+			BitCount:   32,
+			BytesInRes: uint32(len(image)),
+			Offset:     6 + 16,
+		},
+	)
+	buf.Write(image)
+
+	fname := filepath.Join(t.TempDir(), "app.ico")
+	require.NoError(t, os.WriteFile(fname, buf.Bytes(), 0644))
+
+	return fname
+}
+
+func resourceEntries(t testing.TB, rsrc []byte, off uint32) []resourceDirectoryEntry {
+	var dir resourceDirectory
+
+	r := bytes.NewReader(rsrc[off:])
+	require.NoError(t, binary.Read(r, binary.LittleEndian, &dir))
+
+	es := make([]resourceDirectoryEntry, dir.NumberOfIDEntries)
+	require.NoError(t, binary.Read(r, binary.LittleEndian, es))
+
+	return es
+}
+
+func TestEncodeSyso(t *testing.T) {
+	wr, err := config{
+		WindowsResources:   true,
+		WindowsProductName: "Foo",
+		WindowsCompanyName: "Upfluence",
+		WindowsIcon:        writeTestIcon(t),
+	}.windowsResources()
+	require.NoError(t, err)
+
+	rs, err := wr.resources(build{Path: "cmd/foo", Version: "v1.2.3", OS: "windows"}, "foo.exe")
+	require.NoError(t, err)
+
+	buf, err := encodeSyso("amd64", rs)
+	require.NoError(t, err)
+
+	f, err := pe.NewFile(bytes.NewReader(buf))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint16(pe.IMAGE_FILE_MACHINE_AMD64), f.Machine)
+	require.Len(t, f.Sections, 1)
+
+	s := f.Sections[0]
+	assert.Equal(t, ".rsrc", s.Name)
+	assert.Len(t, s.Relocs, 3)
+
+	for _, r := range s.Relocs {
+		assert.Equal(t, uint16(imageRelAMD64Addr32NB), r.Type)
+	}
+
+	rsrc, err := s.Data()
+	require.NoError(t, err)
+
+	var types []uint32
+
+	for _, e := range resourceEntries(t, rsrc, 0) {
+		types = append(types, e.ID)
+	}
+
+	assert.Equal(t, []uint32{rtIcon, rtGroupIcon, rtVersion}, types)
+
+	assert.True(t, bytes.Contains(rsrc, utf16z("ProductName")))
+	assert.True(t, bytes.Contains(rsrc, utf16z("v1.2.3")))
+	assert.True(t, bytes.Contains(rsrc, []byte("fake png image")))
+
+	var fixed [4]byte
+
+	binary.LittleEndian.PutUint32(fixed[:], 0xfeef04bd)
+	assert.True(t, bytes.Contains(rsrc, fixed[:]))
+}
+
+func TestEncodeSysoUnsupportedArch(t *testing.T) {
+	_, err := encodeSyso("mips", nil)
+	assert.Error(t, err)
+}
+
+func TestCompilerWindowsResources(t *testing.T) {
+	var (
+		cctx = testCommandContext(t)
+		dir  = t.TempDir()
+
+		sysos []string
+
+		exc = fakeExecutorWith(
+			execHandlers{
+				"build": func(cmd executil.Command) error {
+					sysos, _ = filepath.Glob(filepath.Join(dir, "*.syso"))
+					return writeOutput(cmd)
+				},
+			},
+		)
+	)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+
+	c := config{
+		DistDir:          t.TempDir(),
+		CompilerPath:     "go",
+		WindowsResources: true,
+	}
+
+	cp, err := newCompiler(c, cctx)
+	require.NoError(t, err)
+
+	cp.executor = exc
+
+	fname, _, err := cp.execute(
+		context.Background(),
+		build{Path: dir, Version: "v1.0.0", OS: "windows", Arch: "amd64"},
+		cctx,
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Base(dir)+".exe", fname)
+	assert.Equal(t, []string{filepath.Join(dir, "zz_compile_go_windows_amd64.syso")}, sysos)
+
+	left, _ := filepath.Glob(filepath.Join(dir, "*.syso"))
+	assert.Empty(t, left)
+}
+
+func TestCheckSysoFiles(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		b   = build{Path: dir, OS: "windows", Arch: "amd64"}
+		sf  = sysoFilename(b)
+	)
+
+	for _, fname := range []string{sf, "rsrc_linux_amd64.syso", "rsrc_windows_arm64.syso"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, filepath.Base(fname)), nil, 0644))
+	}
+
+	assert.NoError(t, checkSysoFiles(b, sf))
+
+	for _, fname := range []string{"rsrc_windows_amd64.syso", "rsrc.syso"} {
+		t.Run(fname, func(t *testing.T) {
+			f := filepath.Join(dir, fname)
+
+			require.NoError(t, os.WriteFile(f, nil, 0644))
+			defer os.Remove(f)
+
+			assert.ErrorContains(t, checkSysoFiles(b, sf), "clashes with the windows resources")
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+var workspaceFiles = []string{"go.work", "go.work.sum"}
+
+type goModule struct {
+	Path string
+	Dir  string
+}
+
+func (c *compiler) goWork(ctx context.Context) (string, error) {
+	out, err := c.output(ctx, nil, "env", "GOWORK")
+
+	if err != nil {
+		return "", errors.Wrap(err, "cant lookup the go workspace")
+	}
+
+	if gw := strings.TrimSpace(out); gw != "off" {
+		return gw, nil
+	}
+
+	return "", nil
+}
+
+func (c *compiler) workspaceModules(ctx context.Context) ([]goModule, error) {
+	var buf bytes.Buffer
+
+	if err := c.executor.Exec(
+		ctx,
+		executil.Command{Cmd: c.path, Args: []string{"list", "-m", "-json"}, Stdout: &buf},
+	); err != nil {
+		return nil, errors.Wrap(err, "cant list the workspace modules")
+	}
+
+	var (
+		ms []goModule
+
+		dec = json.NewDecoder(&buf)
+	)
+
+	for dec.More() {
+		var m goModule
+
+		if err := dec.Decode(&m); err != nil {
+			return nil, errors.Wrap(err, "cant decode go list output")
+		}
+
+		ms = append(ms, m)
+	}
+
+	return ms, nil
+}
+
+func isWithin(dir, p string) bool {
+	rp, err := filepath.Rel(dir, p)
+
+	return err == nil && rp != ".." && !strings.HasPrefix(rp, "../")
+}
+
+// expandPattern rewrites a "..." pattern for every workspace module living
+// under its directory prefix, the go tool only matches a pattern against
+// the module holding its prefix.
+func expandPattern(wd, p string, ms []goModule) []string {
+	var (
+		ps []string
+
+		prefix = filepath.Join(wd, strings.TrimSuffix(p, "..."))
+	)
+
+	for _, m := range ms {
+		ep := p
+
+		if isWithin(prefix, m.Dir) && m.Dir != prefix {
+			ep = "./" + filepath.ToSlash(relativePath(wd, m.Dir)) + "/..."
+		} else if !isWithin(m.Dir, prefix) {
+			continue
+		}
+
+		if !slices.Contains(ps, ep) {
+			ps = append(ps, ep)
+		}
+	}
+
+	return ps
+}
+
+// moduleVersion looks the version of a module up by path then by directory,
+// and falls back to the release version.
+func (c config) moduleVersion(m goModule) string {
+	for _, k := range []string{m.Path, m.Dir} {
+		if v, ok := c.ModuleVersions[k]; ok && k != "" {
+			return v
+		}
+	}
+
+	return c.Version
+}
+
+func moduleVersions(bs []build) map[string]string {
+	vs := make(map[string]string)
+
+	for _, b := range bs {
+		if b.Module.Path != "" {
+			vs[b.Module.Path] = b.Version
+		}
+	}
+
+	return vs
+}
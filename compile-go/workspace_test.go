@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+func TestCompilerExecutablesWorkspace(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	var (
+		cctx = testCommandContext(t)
+		foo  = filepath.Join(wd, "svc", "foo")
+		bar  = filepath.Join(wd, "tools")
+
+		exc = fakeExecutorWith(
+			execHandlers{
+				"env": printOutput(filepath.Join(wd, "go.work") + "\n"),
+				"list": func(cmd executil.Command) error {
+					if cmd.Args[1] == "-m" {
+						_, err := fmt.Fprintf(
+							cmd.Stdout,
+							`{"Path":"example.com/foo","Dir":%q}
+{"Path":"example.com/tools","Dir":%q}`,
+							foo,
+							bar,
+						)
+
+						return err
+					}
+
+					_, err := fmt.Fprintf(
+						cmd.Stdout,
+						`{"ImportPath":"example.com/foo/cmd/foo","Name":"main","Dir":%q,"Match":["./..."],"Module":{"Path":"example.com/foo","Dir":%q}}
+{"ImportPath":"example.com/foo/pkg/lib","Name":"lib","Dir":%q,"Match":["./..."],"Module":{"Path":"example.com/foo","Dir":%q}}
+{"ImportPath":"example.com/tools/cmd/bar","Name":"main","Dir":%q,"Match":["./..."],"Module":{"Path":"example.com/tools","Dir":%q}}`,
+						filepath.Join(foo, "cmd", "foo"),
+						foo,
+						filepath.Join(foo, "pkg", "lib"),
+						foo,
+						filepath.Join(bar, "cmd", "bar"),
+						bar,
+					)
+
+					return err
+				},
+			},
+		)
+
+		c = config{
+			Version:         "v1.0.0",
+			ModuleVersions:  map[string]string{"tools": "v2.3.0"},
+			ExecutablePaths: []string{"./..."},
+			OSs:             []string{"linux"},
+			Archs:           []string{"amd64"},
+			CompilerPath:    "go",
+			AdditionalLinks: map[string]string{"main.Module": "{{ .Module }}@{{ .Version }}"},
+		}
+	)
+
+	cp, err := newCompiler(c, cctx)
+	require.NoError(t, err)
+
+	cp.executor = exc
+
+	exes, err := cp.executables(context.Background(), c, cctx)
+	require.NoError(t, err)
+
+	lists := commandsOf(exc, "list")
+	require.Len(t, lists, 2)
+	assert.Equal(t, []string{"list", "-e", "-json", "./svc/foo/...", "./tools/..."}, lists[1].Args)
+
+	assert.Equal(
+		t,
+		[]executable{
+			{
+				Path:   "svc/foo/cmd/foo",
+				Module: goModule{Path: "example.com/foo", Dir: "svc/foo"},
+			},
+			{
+				Path:   "tools/cmd/bar",
+				Module: goModule{Path: "example.com/tools", Dir: "tools"},
+			},
+		},
+		exes,
+	)
+
+	bs, err := c.builds(cctx, exes)
+	require.NoError(t, err)
+	require.Len(t, bs, 2)
+
+	assert.Equal(t, "v1.0.0", bs[0].Version)
+	assert.Equal(t, map[string]string{"main.Module": "example.com/foo@v1.0.0"}, bs[0].links)
+	assert.Equal(t, "v2.3.0", bs[1].Version)
+	assert.Equal(t, map[string]string{"main.Module": "example.com/tools@v2.3.0"}, bs[1].links)
+
+	assert.Equal(
+		t,
+		map[string]string{"example.com/foo": "v1.0.0", "example.com/tools": "v2.3.0"},
+		moduleVersions(bs),
+	)
+}
+
+func TestExpandPattern(t *testing.T) {
+	ms := []goModule{{Path: "example.com/a", Dir: "/ws/a"}, {Path: "example.com/b", Dir: "/ws/nested/b"}}
+
+	assert.Equal(t, []string{"./a/...", "./nested/b/..."}, expandPattern("/ws", "./...", ms))
+	assert.Equal(t, []string{"./nested/b/..."}, expandPattern("/ws", "./nested/...", ms))
+	assert.Equal(t, []string{"./a/cmd/..."}, expandPattern("/ws", "./a/cmd/...", ms))
+	assert.Empty(t, expandPattern("/ws", "./other/...", ms))
+
+	ms = append(ms, goModule{Path: "example.com/root", Dir: "/ws"})
+	assert.Equal(t, []string{"./a/...", "./nested/b/...", "./..."}, expandPattern("/ws", "./...", ms))
+}
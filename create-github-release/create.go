@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/go-github/v53/github"
 	"github.com/upfluence/actions/pkg/toolkit"
@@ -17,21 +19,93 @@ type config struct {
 	Prerelease  bool     `flag:"prerelease"`
 }
 
+// attachments expands the attachment globs relative to the workspace into
+// the files to upload, directories are walked and globs prefixed by !
+// exclude the files and directories they match (i.e. dist/*,!dist/.*).
+// Assets are named after the base name of their file so two files sharing
+// one are rejected.
 func (c config) attachments(cctx toolkit.CommandContext) ([]string, error) {
-	var paths []string
+	var includes, excludes []string
+
 	for _, att := range c.Attachments {
+		if !strings.HasPrefix(att, "!") {
+			includes = append(includes, att)
+			continue
+		}
+
+		if _, err := filepath.Match(att[1:], ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid glob %q", att)
+		}
+
+		excludes = append(excludes, att)
+	}
+
+	var (
+		paths []string
+
+		names = make(map[string]string)
+	)
+
+	for _, att := range includes {
 		fnames, err := filepath.Glob(filepath.Join(cctx.Workspace, att))
 
 		if err != nil {
 			return nil, errors.Wrapf(err, "invalid glob %q", att)
 		}
 
-		paths = append(paths, fnames...)
+		for _, fname := range fnames {
+			if err := filepath.WalkDir(fname, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if ex, ok := excluded(cctx.Workspace, p, excludes); ok {
+					cctx.Logger.Infof("Skipping %s: excluded by %s", p, ex)
+
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+
+					return nil
+				}
+
+				if d.IsDir() {
+					return nil
+				}
+
+				name := filepath.Base(p)
+
+				if op, ok := names[name]; ok {
+					if op == p {
+						return nil
+					}
+
+					return fmt.Errorf("%s and %s would both be uploaded as %s", op, p, name)
+				}
+
+				names[name] = p
+				paths = append(paths, p)
+
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return paths, nil
 }
 
+func excluded(wd, fname string, excludes []string) (string, bool) {
+	for _, ex := range excludes {
+		if ok, _ := filepath.Match(filepath.Join(wd, ex[1:]), fname); ok {
+			return ex, true
+		}
+	}
+
+	return "", false
+}
+
 func main() {
 	toolkit.NewApp(
 		"create-github-release",
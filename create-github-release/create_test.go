@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/upfluence/log/logtest"
+
+	"github.com/upfluence/actions/pkg/toolkit"
+)
+
+func TestConfigAttachments(t *testing.T) {
+	var (
+		wd   = t.TempDir()
+		cctx = toolkit.CommandContext{Logger: logtest.WrapTestingLogger(t), Workspace: wd}
+	)
+
+	require.NoError(t, os.Mkdir(filepath.Join(wd, "dist"), 0755))
+
+	for _, fname := range []string{"foo-linux-amd64", "foo-darwin-arm64", ".compile-go-cache.json", "ghcr.io_upfluence_foo.oci.tar"} {
+		require.NoError(t, os.WriteFile(filepath.Join(wd, "dist", fname), nil, 0644))
+	}
+
+	for _, tt := range []struct {
+		name        string
+		attachments []string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:        "all",
+			attachments: []string{"dist/*"},
+			want: []string{
+				".compile-go-cache.json",
+				"foo-darwin-arm64",
+				"foo-linux-amd64",
+				"ghcr.io_upfluence_foo.oci.tar",
+			},
+		},
+		{
+			name:        "exclusions",
+			attachments: []string{"dist/*", "!dist/.*", "!dist/*.oci.tar"},
+			want:        []string{"foo-darwin-arm64", "foo-linux-amd64"},
+		},
+		{
+			name:        "invalid exclusion",
+			attachments: []string{"dist/*", "!dist/["},
+			wantErr:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := config{Attachments: tt.attachments}.attachments(cctx)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			var fnames []string
+
+			for _, p := range paths {
+				fnames = append(fnames, filepath.Base(p))
+			}
+
+			assert.Equal(t, tt.want, fnames)
+		})
+	}
+}
+
+func TestConfigAttachmentsDirectories(t *testing.T) {
+	var (
+		wd   = t.TempDir()
+		cctx = toolkit.CommandContext{Logger: logtest.WrapTestingLogger(t), Workspace: wd}
+	)
+
+	for _, fname := range []string{
+		"dist/foo-linux-amd64",
+		"dist/completions/_foo",
+		"dist/completions/foo.bash",
+		"dist/man/foo.1",
+		"dist/.cache/foo.1",
+	} {
+		fname = filepath.Join(wd, fname)
+
+		require.NoError(t, os.MkdirAll(filepath.Dir(fname), 0755))
+		require.NoError(t, os.WriteFile(fname, nil, 0644))
+	}
+
+	paths, err := config{Attachments: []string{"dist/*", "dist/man", "!dist/.*"}}.attachments(cctx)
+	require.NoError(t, err)
+
+	var fnames []string
+
+	for _, p := range paths {
+		rp, err := filepath.Rel(wd, p)
+		require.NoError(t, err)
+
+		fnames = append(fnames, filepath.ToSlash(rp))
+	}
+
+	assert.Equal(
+		t,
+		[]string{"dist/completions/_foo", "dist/completions/foo.bash", "dist/foo-linux-amd64", "dist/man/foo.1"},
+		fnames,
+	)
+
+	_, err = config{Attachments: []string{"dist/*"}}.attachments(cctx)
+	assert.ErrorContains(t, err, "would both be uploaded as foo.1")
+}
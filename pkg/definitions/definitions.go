@@ -0,0 +1,326 @@
+// Package definitions describes the artifacts produced by compile-go and
+// consumed by publish-cli and update-homebrew-formula.
+package definitions
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/upfluence/errors"
+)
+
+// SchemaVersion is the version of the format written by Marshal. Version 1
+// is the legacy map[name]map[os/arch]{filename, sha256} format.
+const SchemaVersion = 2
+
+type Kind string
+
+const (
+	Binary          Kind = "binary"
+	UniversalBinary Kind = "universal-binary"
+	Archive         Kind = "archive"
+)
+
+func (Kind) schemaEnum() []string {
+	return []string{string(Binary), string(UniversalBinary), string(Archive)}
+}
+
+type DocumentKind string
+
+const (
+	Completion DocumentKind = "completion"
+	ManPage    DocumentKind = "man-page"
+)
+
+func (DocumentKind) schemaEnum() []string {
+	return []string{string(Completion), string(ManPage)}
+}
+
+type Checksums struct {
+	SHA256 string `json:"sha256" description:"hex encoded SHA-256 of the artifact"`
+}
+
+type ArchiveInfo struct {
+	Format string `json:"format" description:"archive format, i.e. tar.gz or zip"`
+	Member string `json:"member,omitempty" description:"path of the binary within the archive"`
+}
+
+type SBOM struct {
+	Format string `json:"format" description:"SBOM format, cyclonedx or spdx"`
+	Path   string `json:"path" description:"path of the SBOM document"`
+}
+
+type Artifact struct {
+	Name      string       `json:"name" description:"name of the executable"`
+	Module    string       `json:"module,omitempty" description:"path of the go module holding the executable"`
+	Version   string       `json:"version,omitempty" description:"release version of the module"`
+	GoVersion string       `json:"go_version,omitempty" description:"version of the go toolchain which built the artifact"`
+	Kind      Kind         `json:"kind" description:"kind of artifact"`
+	Path      string       `json:"path" description:"path of the artifact, relative to the dist dir"`
+	Size      int64        `json:"size,omitempty" description:"size of the artifact in bytes"`
+	Checksums Checksums    `json:"checksums" description:"checksums of the artifact"`
+	OS        string       `json:"os" description:"GOOS of the artifact"`
+	Arch      string       `json:"arch" description:"GOARCH of the artifact, all for universal binaries"`
+	Variant   string       `json:"variant,omitempty" description:"architecture variant, i.e. v7 for arm"`
+	Archive   *ArchiveInfo `json:"archive,omitempty" description:"set when the artifact is an archive"`
+	SBOMs     []SBOM       `json:"sboms,omitempty" description:"SBOM documents describing the artifact"`
+}
+
+// Target returns the os/arch key the artifact was indexed by in the legacy
+// format, suffixed by the variant when there is one.
+func (a Artifact) Target() string {
+	t := fmt.Sprintf("%s/%s", a.OS, a.Arch)
+
+	if a.Variant != "" {
+		t += "/" + a.Variant
+	}
+
+	return t
+}
+
+func (a Artifact) Filename() string {
+	return path.Base(a.Path)
+}
+
+// Image is a multi-platform container image assembled from the linux
+// binaries of an executable.
+type Image struct {
+	Name       string   `json:"name" description:"name of the executable"`
+	Module     string   `json:"module,omitempty" description:"path of the go module holding the executable"`
+	Version    string   `json:"version,omitempty" description:"release version of the module"`
+	Repository string   `json:"repository" description:"repository of the image, i.e. ghcr.io/upfluence/foo"`
+	Tags       []string `json:"tags" description:"tags of the image"`
+	Digest     string   `json:"digest" description:"digest of the image index"`
+	Platforms  []string `json:"platforms" description:"platforms of the image, i.e. linux/amd64"`
+	Path       string   `json:"path,omitempty" description:"path of the OCI layout tarball relative to the dist dir, unset when the image was pushed"`
+}
+
+// Document is a shell completion script or a man page generated by an
+// executable.
+type Document struct {
+	Name      string       `json:"name" description:"name of the executable"`
+	Kind      DocumentKind `json:"kind" description:"kind of document"`
+	Shell     string       `json:"shell,omitempty" description:"shell of the completion script, bash, zsh or fish"`
+	Section   int          `json:"section,omitempty" description:"section of the man page"`
+	Path      string       `json:"path" description:"path of the document, relative to the dist dir"`
+	Checksums Checksums    `json:"checksums" description:"checksums of the document"`
+}
+
+func (d Document) Filename() string {
+	return path.Base(d.Path)
+}
+
+type Definitions struct {
+	SchemaVersion int        `json:"schema_version" description:"version of the definitions format"`
+	Artifacts     []Artifact `json:"artifacts" description:"artifacts produced by the build"`
+	Images        []Image    `json:"images,omitempty" description:"container images produced by the build"`
+	Documents     []Document `json:"documents,omitempty" description:"completion scripts and man pages generated by the executables"`
+}
+
+func (d Definitions) Names() []string {
+	var ns []string
+
+	for _, a := range d.Artifacts {
+		if !slices.Contains(ns, a.Name) {
+			ns = append(ns, a.Name)
+		}
+	}
+
+	return ns
+}
+
+// Filter returns the definitions restricted to the artifacts, images and
+// documents of the given executable.
+func (d Definitions) Filter(name string) Definitions {
+	fd := Definitions{SchemaVersion: d.SchemaVersion}
+
+	for _, a := range d.Artifacts {
+		if a.Name == name {
+			fd.Artifacts = append(fd.Artifacts, a)
+		}
+	}
+
+	for _, i := range d.Images {
+		if i.Name == name {
+			fd.Images = append(fd.Images, i)
+		}
+	}
+
+	for _, doc := range d.Documents {
+		if doc.Name == name {
+			fd.Documents = append(fd.Documents, doc)
+		}
+	}
+
+	return fd
+}
+
+func (d Definitions) Lookup(name, target string) (Artifact, bool) {
+	for _, a := range d.Artifacts {
+		if a.Name == name && a.Target() == target {
+			return a, true
+		}
+	}
+
+	return Artifact{}, false
+}
+
+func (d Definitions) Marshal() ([]byte, error) {
+	d.SchemaVersion = SchemaVersion
+
+	if d.Artifacts == nil {
+		d.Artifacts = []Artifact{}
+	}
+
+	return json.Marshal(d)
+}
+
+type Format int
+
+const (
+	Versioned Format = iota
+	Legacy
+)
+
+func (f *Format) Parse(v string) error {
+	switch v {
+	case "versioned":
+		*f = Versioned
+	case "legacy":
+		*f = Legacy
+	default:
+		return fmt.Errorf("Invalid definitions-format %q", v)
+	}
+
+	return nil
+}
+
+// LegacyBinary is a binary in the legacy format, indexed by os/arch.
+type LegacyBinary struct {
+	Filename string   `json:"filename"`
+	Sha256   string   `json:"sha256"`
+	SBOMs    []string `json:"sboms,omitempty"`
+}
+
+// Legacy returns the binaries of d in the legacy format, keyed by name then
+// by target. Archives, images and documents have no legacy counterpart.
+func (d Definitions) Legacy() map[string]map[string]LegacyBinary {
+	res := make(map[string]map[string]LegacyBinary)
+
+	for _, a := range d.Artifacts {
+		if a.Kind != Binary && a.Kind != UniversalBinary {
+			continue
+		}
+
+		if _, ok := res[a.Name]; !ok {
+			res[a.Name] = make(map[string]LegacyBinary)
+		}
+
+		lb := LegacyBinary{Filename: a.Path, Sha256: a.Checksums.SHA256}
+
+		for _, s := range a.SBOMs {
+			lb.SBOMs = append(lb.SBOMs, s.Path)
+		}
+
+		res[a.Name][a.Target()] = lb
+	}
+
+	return res
+}
+
+func (lb LegacyBinary) artifact(name, target string) Artifact {
+	a := Artifact{
+		Name:      name,
+		Kind:      Binary,
+		Path:      lb.Filename,
+		Checksums: Checksums{SHA256: lb.Sha256},
+	}
+
+	ps := strings.SplitN(target, "/", 3)
+
+	a.OS = ps[0]
+
+	if len(ps) > 1 {
+		a.Arch = ps[1]
+	}
+
+	if len(ps) > 2 {
+		a.Variant = ps[2]
+	}
+
+	if a.Arch == "all" {
+		a.Kind = UniversalBinary
+	}
+
+	for _, s := range lb.SBOMs {
+		f := "cyclonedx"
+
+		if strings.HasSuffix(s, ".spdx.json") {
+			f = "spdx"
+		}
+
+		a.SBOMs = append(a.SBOMs, SBOM{Format: f, Path: s})
+	}
+
+	return a
+}
+
+// Unmarshal decodes the versioned format as well as the legacy formats: the
+// map[name]map[os/arch]binary written by compile-go and the map[os/arch]binary
+// forwarded by publish-cli, in which case the artifacts are named after
+// defaultName.
+func Unmarshal(buf []byte, defaultName string) (Definitions, error) {
+	var probe map[string]json.RawMessage
+
+	if err := json.Unmarshal(buf, &probe); err != nil {
+		return Definitions{}, errors.Wrap(err, "invalid definitions")
+	}
+
+	if _, ok := probe["schema_version"]; ok {
+		var d Definitions
+
+		if err := json.Unmarshal(buf, &d); err != nil {
+			return Definitions{}, errors.Wrap(err, "invalid definitions")
+		}
+
+		if d.SchemaVersion > SchemaVersion {
+			return Definitions{}, fmt.Errorf(
+				"definitions schema version %d is not supported, max is %d",
+				d.SchemaVersion,
+				SchemaVersion,
+			)
+		}
+
+		return d, nil
+	}
+
+	d := Definitions{SchemaVersion: 1}
+
+	var byName map[string]map[string]LegacyBinary
+
+	if err := json.Unmarshal(buf, &byName); err == nil {
+		for _, n := range slices.Sorted(maps.Keys(byName)) {
+			for _, t := range slices.Sorted(maps.Keys(byName[n])) {
+				d.Artifacts = append(d.Artifacts, byName[n][t].artifact(n, t))
+			}
+		}
+
+		return d, nil
+	}
+
+	var byTarget map[string]LegacyBinary
+
+	if err := json.Unmarshal(buf, &byTarget); err != nil {
+		return Definitions{}, errors.Wrap(err, "invalid definitions")
+	}
+
+	for _, t := range slices.Sorted(maps.Keys(byTarget)) {
+		d.Artifacts = append(d.Artifacts, byTarget[t].artifact(defaultName, t))
+	}
+
+	return d, nil
+}
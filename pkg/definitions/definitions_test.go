@@ -0,0 +1,206 @@
+package definitions
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "regenerate schema.json")
+
+func TestUnmarshal(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   string
+
+		want    Definitions
+		wantErr bool
+	}{
+		{
+			name: "legacy compile-go output",
+			in: `{"foo":{"linux/amd64":{"filename":"foo-linux","sha256":"abc","sboms":["foo-linux.spdx.json"]},` +
+				`"darwin/all":{"filename":"foo-darwin","sha256":"def"}}}`,
+			want: Definitions{
+				SchemaVersion: 1,
+				Artifacts: []Artifact{
+					{
+						Name:      "foo",
+						Kind:      UniversalBinary,
+						Path:      "foo-darwin",
+						Checksums: Checksums{SHA256: "def"},
+						OS:        "darwin",
+						Arch:      "all",
+					},
+					{
+						Name:      "foo",
+						Kind:      Binary,
+						Path:      "foo-linux",
+						Checksums: Checksums{SHA256: "abc"},
+						OS:        "linux",
+						Arch:      "amd64",
+						SBOMs:     []SBOM{{Format: "spdx", Path: "foo-linux.spdx.json"}},
+					},
+				},
+			},
+		},
+		{
+			name: "legacy publish-cli binaries",
+			in:   `{"linux/arm/v7":{"filename":"foo-arm","sha256":"abc"}}`,
+			want: Definitions{
+				SchemaVersion: 1,
+				Artifacts: []Artifact{
+					{
+						Name:      "bar",
+						Kind:      Binary,
+						Path:      "foo-arm",
+						Checksums: Checksums{SHA256: "abc"},
+						OS:        "linux",
+						Arch:      "arm",
+						Variant:   "v7",
+					},
+				},
+			},
+		},
+		{
+			name: "versioned",
+			in: `{"schema_version":2,"artifacts":[{"name":"foo","kind":"binary","path":"foo",` +
+				`"size":12,"checksums":{"sha256":"abc"},"os":"linux","arch":"amd64"}]}`,
+			want: Definitions{
+				SchemaVersion: 2,
+				Artifacts: []Artifact{
+					{
+						Name:      "foo",
+						Kind:      Binary,
+						Path:      "foo",
+						Size:      12,
+						Checksums: Checksums{SHA256: "abc"},
+						OS:        "linux",
+						Arch:      "amd64",
+					},
+				},
+			},
+		},
+		{name: "future version", in: `{"schema_version":3,"artifacts":[]}`, wantErr: true},
+		{name: "invalid", in: `[]`, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Unmarshal([]byte(tt.in), "bar")
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, d)
+		})
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	d := Definitions{
+		Artifacts: []Artifact{
+			{Name: "foo", Kind: Binary, Path: "foo.exe", OS: "windows", Arch: "amd64"},
+		},
+	}
+
+	buf, err := d.Marshal()
+	require.NoError(t, err)
+
+	rd, err := Unmarshal(buf, "")
+	require.NoError(t, err)
+
+	d.SchemaVersion = SchemaVersion
+	assert.Equal(t, d, rd)
+
+	a, ok := rd.Lookup("foo", "windows/amd64")
+	assert.True(t, ok)
+	assert.Equal(t, "foo.exe", a.Filename())
+}
+
+func TestLegacyRoundTrip(t *testing.T) {
+	d := Definitions{
+		Artifacts: []Artifact{
+			{
+				Name:      "foo",
+				Kind:      Binary,
+				Path:      "foo-linux-amd64",
+				OS:        "linux",
+				Arch:      "amd64",
+				Checksums: Checksums{SHA256: "abc"},
+				SBOMs:     []SBOM{{Format: "spdx", Path: "foo-linux-amd64.spdx.json"}},
+			},
+			{Name: "foo", Kind: UniversalBinary, Path: "foo-darwin", OS: "darwin", Arch: "all"},
+			{Name: "foo", Kind: Archive, Path: "foo-linux-amd64.tar.gz", OS: "linux", Arch: "amd64"},
+		},
+	}
+
+	buf, err := json.Marshal(d.Legacy())
+	require.NoError(t, err)
+
+	assert.JSONEq(
+		t,
+		`{"foo":{
+  "linux/amd64":{"filename":"foo-linux-amd64","sha256":"abc","sboms":["foo-linux-amd64.spdx.json"]},
+  "darwin/all":{"filename":"foo-darwin","sha256":""}
+}}`,
+		string(buf),
+	)
+
+	rd, err := Unmarshal(buf, "")
+	require.NoError(t, err)
+
+	d.SchemaVersion = 1
+	d.Artifacts = []Artifact{d.Artifacts[1], d.Artifacts[0]}
+	assert.Equal(t, d, rd)
+
+	var f Format
+
+	require.NoError(t, f.Parse("legacy"))
+	assert.Equal(t, Legacy, f)
+	assert.Error(t, f.Parse("v1"))
+}
+
+func TestFilter(t *testing.T) {
+	d := Definitions{
+		SchemaVersion: SchemaVersion,
+		Artifacts: []Artifact{
+			{Name: "foo", Kind: Binary, Path: "foo", OS: "linux", Arch: "amd64"},
+			{Name: "bar", Kind: Binary, Path: "bar", OS: "linux", Arch: "amd64"},
+		},
+		Images: []Image{{Name: "bar", Repository: "ghcr.io/upfluence/bar"}},
+		Documents: []Document{
+			{Name: "foo", Kind: Completion, Shell: "zsh", Path: "completions/_foo"},
+			{Name: "bar", Kind: ManPage, Section: 1, Path: "man/bar.1"},
+		},
+	}
+
+	assert.Equal(t, []string{"foo", "bar"}, d.Names())
+
+	fd := d.Filter("foo")
+
+	assert.Len(t, fd.Artifacts, 1)
+	assert.Empty(t, fd.Images)
+	assert.Equal(t, []Document{d.Documents[0]}, fd.Documents)
+	assert.Equal(t, "_foo", fd.Documents[0].Filename())
+}
+
+func TestJSONSchema(t *testing.T) {
+	buf, err := JSONSchema()
+	require.NoError(t, err)
+
+	buf = append(buf, '\n')
+
+	if *update {
+		require.NoError(t, os.WriteFile("schema.json", buf, 0644))
+	}
+
+	want, err := os.ReadFile("schema.json")
+	require.NoError(t, err)
+
+	assert.Equal(t, string(want), string(buf), "schema.json is outdated, run go test -update")
+}
@@ -0,0 +1,81 @@
+package definitions
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const schemaID = "https://raw.githubusercontent.com/upfluence/actions/master/pkg/definitions/schema.json"
+
+type enum interface {
+	schemaEnum() []string
+}
+
+var enumType = reflect.TypeOf((*enum)(nil)).Elem()
+
+func typeSchema(t reflect.Type) map[string]any {
+	if t.Implements(enumType) {
+		return map[string]any{
+			"type": "string",
+			"enum": reflect.Zero(t).Interface().(enum).schemaEnum(),
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		var (
+			required []string
+
+			properties = make(map[string]any)
+		)
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+
+			s := typeSchema(f.Type)
+
+			if d := f.Tag.Get("description"); d != "" {
+				s["description"] = d
+			}
+
+			properties[name] = s
+
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+
+		return map[string]any{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+	}
+
+	panic(fmt.Sprintf("type %v not supported by the schema generator", t))
+}
+
+// JSONSchema returns the JSON Schema (draft 2020-12) of the definitions
+// written by Marshal.
+func JSONSchema() ([]byte, error) {
+	s := typeSchema(reflect.TypeOf(Definitions{}))
+
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = schemaID
+	s["title"] = "compile-go definitions"
+	s["properties"].(map[string]any)["schema_version"].(map[string]any)["const"] = SchemaVersion
+
+	return json.MarshalIndent(s, "", "  ")
+}
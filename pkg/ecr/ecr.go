@@ -0,0 +1,268 @@
+// Package ecr exchanges AWS credentials for the registry credentials of
+// Amazon ECR, as aws ecr get-login-password does.
+package ecr
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/upfluence/errors"
+
+	"github.com/upfluence/actions/pkg/oci"
+)
+
+const (
+	service = "ecr"
+	target  = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+
+	amzDateFormat = "20060102T150405Z"
+)
+
+var registryRegexp = regexp.MustCompile(
+	`^([0-9]{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`,
+)
+
+// ParseRegistry extracts the account and region of an ECR registry host,
+// i.e. 123456789012.dkr.ecr.eu-west-1.amazonaws.com.
+func ParseRegistry(host string) (account, region string, ok bool) {
+	m := registryRegexp.FindStringSubmatch(host)
+
+	if m == nil {
+		return "", "", false
+	}
+
+	return m[1], m[2], true
+}
+
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv reads the credentials exported by
+// aws-actions/configure-aws-credentials.
+func CredentialsFromEnv() (Credentials, bool) {
+	c := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	return c, c.AccessKeyID != "" && c.SecretAccessKey != ""
+}
+
+type Client struct {
+	HTTPClient  *http.Client
+	Credentials Credentials
+
+	// Endpoint overrides https://api.ecr.<region>.amazonaws.com, i.e. for a
+	// VPC endpoint or a local stand-in.
+	Endpoint string
+
+	now func() time.Time
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+func (c *Client) endpoint(region string) string {
+	if c.Endpoint != "" {
+		return c.Endpoint
+	}
+
+	return fmt.Sprintf("https://api.ecr.%s.amazonaws.com/", region)
+}
+
+// Login returns the credential of the registry of account in region, valid
+// for 12 hours.
+func (c *Client) Login(ctx context.Context, account, region string) (oci.Credential, error) {
+	body, err := json.Marshal(map[string][]string{"registryIds": {account}})
+
+	if err != nil {
+		return oci.Credential{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(region), bytes.NewReader(body))
+
+	if err != nil {
+		return oci.Credential{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+
+	now := time.Now
+
+	if c.now != nil {
+		now = c.now
+	}
+
+	c.sign(req, body, region, service, now().UTC())
+
+	resp, err := c.httpClient().Do(req)
+
+	if err != nil {
+		return oci.Credential{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+
+		json.NewDecoder(resp.Body).Decode(&e)
+
+		return oci.Credential{}, fmt.Errorf(
+			"GetAuthorizationToken failed with status %d: %s %s",
+			resp.StatusCode,
+			e.Type,
+			e.Message,
+		)
+	}
+
+	var res struct {
+		AuthorizationData []struct {
+			AuthorizationToken string `json:"authorizationToken"`
+		} `json:"authorizationData"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return oci.Credential{}, errors.Wrap(err, "cant decode the GetAuthorizationToken response")
+	}
+
+	if len(res.AuthorizationData) == 0 {
+		return oci.Credential{}, errors.New("GetAuthorizationToken returned no token")
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(res.AuthorizationData[0].AuthorizationToken)
+
+	if err != nil {
+		return oci.Credential{}, errors.Wrap(err, "invalid authorization token")
+	}
+
+	u, p, ok := strings.Cut(string(buf), ":")
+
+	if !ok {
+		return oci.Credential{}, errors.New("invalid authorization token")
+	}
+
+	return oci.Credential{Username: u, Password: p}, nil
+}
+
+func hmacSHA256(key []byte, v string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(v))
+
+	return h.Sum(nil)
+}
+
+func sha256Hex(buf []byte) string {
+	h := sha256.Sum256(buf)
+
+	return hex.EncodeToString(h[:])
+}
+
+// sign adds the AWS signature version 4 headers to req.
+func (c *Client) sign(req *http.Request, body []byte, region, service string, t time.Time) {
+	var (
+		amzDate = t.Format(amzDateFormat)
+		date    = t.Format("20060102")
+		scope   = strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	if c.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.Credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+
+	for k, vs := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(vs, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+
+	for k := range headers {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, strings.TrimSpace(headers[k]))
+	}
+
+	path := req.URL.EscapedPath()
+
+	if path == "" {
+		path = "/"
+	}
+
+	var (
+		signedHeaders = strings.Join(names, ";")
+
+		canonicalRequest = strings.Join(
+			[]string{
+				req.Method,
+				path,
+				canonicalQuery(req.URL.Query()),
+				canonicalHeaders.String(),
+				signedHeaders,
+				sha256Hex(body),
+			},
+			"\n",
+		)
+
+		stringToSign = strings.Join(
+			[]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))},
+			"\n",
+		)
+
+		key = hmacSHA256([]byte("AWS4"+c.Credentials.SecretAccessKey), date)
+	)
+
+	for _, v := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+
+	req.Header.Set(
+		"Authorization",
+		fmt.Sprintf(
+			"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+			c.Credentials.AccessKeyID,
+			scope,
+			signedHeaders,
+			hex.EncodeToString(hmacSHA256(key, stringToSign)),
+		),
+	)
+}
+
+func canonicalQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
@@ -0,0 +1,106 @@
+package ecr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/oci"
+)
+
+var testCredentials = Credentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+func TestSign(t *testing.T) {
+	// example of the signature version 4 documentation
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	c := Client{Credentials: testCredentials}
+	c.sign(req, nil, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(
+		t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+			"SignedHeaders=content-type;host;x-amz-date, "+
+			"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"),
+	)
+}
+
+func TestParseRegistry(t *testing.T) {
+	account, region, ok := ParseRegistry("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+
+	assert.True(t, ok)
+	assert.Equal(t, "123456789012", account)
+	assert.Equal(t, "eu-west-1", region)
+
+	_, _, ok = ParseRegistry("ghcr.io")
+	assert.False(t, ok)
+}
+
+func TestClientLogin(t *testing.T) {
+	srv := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			buf, _ := io.ReadAll(r.Body)
+
+			if r.Header.Get("X-Amz-Target") != target ||
+				r.Header.Get("X-Amz-Security-Token") != "session" ||
+				!strings.HasPrefix(
+					r.Header.Get("Authorization"),
+					"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240102/eu-west-1/ecr/aws4_request, ",
+				) {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"__type":"AccessDeniedException","message":"denied"}`)
+				return
+			}
+
+			var req struct {
+				RegistryIDs []string `json:"registryIds"`
+			}
+
+			json.Unmarshal(buf, &req)
+
+			fmt.Fprintf(
+				w,
+				`{"authorizationData":[{"authorizationToken":%q,"proxyEndpoint":"https://%s.dkr.ecr.eu-west-1.amazonaws.com"}]}`,
+				base64.StdEncoding.EncodeToString([]byte("AWS:pass-"+req.RegistryIDs[0])),
+				req.RegistryIDs[0],
+			)
+		}),
+	)
+
+	defer srv.Close()
+
+	creds := testCredentials
+	creds.SessionToken = "session"
+
+	c := Client{
+		Credentials: creds,
+		Endpoint:    srv.URL,
+		now:         func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+
+	cred, err := c.Login(context.Background(), "123456789012", "eu-west-1")
+	require.NoError(t, err)
+	assert.Equal(t, oci.Credential{Username: "AWS", Password: "pass-123456789012"}, cred)
+
+	c.Credentials.SessionToken = ""
+
+	_, err = c.Login(context.Background(), "123456789012", "eu-west-1")
+	assert.ErrorContains(t, err, "AccessDeniedException")
+}
@@ -0,0 +1,34 @@
+package executiltest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/upfluence/actions/pkg/executil"
+)
+
+type Executor struct {
+	ExecFunc func(context.Context, executil.Command) error
+
+	mu       sync.Mutex
+	commands []executil.Command
+}
+
+func (e *Executor) Exec(ctx context.Context, cmd executil.Command) error {
+	e.mu.Lock()
+	e.commands = append(e.commands, cmd)
+	e.mu.Unlock()
+
+	if e.ExecFunc == nil {
+		return nil
+	}
+
+	return e.ExecFunc(ctx, cmd)
+}
+
+func (e *Executor) Commands() []executil.Command {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]executil.Command(nil), e.commands...)
+}
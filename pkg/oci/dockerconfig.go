@@ -0,0 +1,165 @@
+package oci
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/upfluence/errors"
+)
+
+const dockerHubServer = "https://index.docker.io/v1/"
+
+type dockerAuth struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// DockerConfig is the credential store of the docker CLI, the config.json
+// file written by docker login.
+type DockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths,omitempty"`
+	CredsStore  string                `json:"credsStore,omitempty"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+}
+
+// DockerConfigDir returns the directory of the docker config, DOCKER_CONFIG
+// or ~/.docker.
+func DockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".docker"), nil
+}
+
+// LoadDockerConfig reads the config.json of dir, a missing file is an empty
+// config.
+func LoadDockerConfig(dir string) (*DockerConfig, error) {
+	var dc DockerConfig
+
+	buf, err := os.ReadFile(filepath.Join(dir, "config.json"))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return &dc, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &dc); err != nil {
+		return nil, errors.Wrapf(err, "invalid docker config in %q", dir)
+	}
+
+	return &dc, nil
+}
+
+// serverKeys lists the keys a registry may be stored under, docker hub is
+// stored under its legacy v1 URL.
+func serverKeys(registry string) []string {
+	if registry == dockerHub {
+		return []string{dockerHubServer, "index.docker.io", dockerHub}
+	}
+
+	return []string{registry, "https://" + registry, "http://" + registry}
+}
+
+func (dc *DockerConfig) helper(registry string) string {
+	for _, k := range serverKeys(registry) {
+		if h, ok := dc.CredHelpers[k]; ok {
+			return h
+		}
+	}
+
+	return dc.CredsStore
+}
+
+// Credential looks registry up in the auths of the config, then in its
+// credential helpers.
+func (dc *DockerConfig) Credential(registry string) (Credential, bool, error) {
+	for _, k := range serverKeys(registry) {
+		a, ok := dc.Auths[k]
+
+		if !ok {
+			continue
+		}
+
+		if a.Auth == "" && a.Username == "" {
+			// docker login records the registry without secret when the
+			// credential lives in a helper
+			break
+		}
+
+		if a.Auth == "" {
+			return Credential{Username: a.Username, Password: a.Password}, true, nil
+		}
+
+		buf, err := base64.StdEncoding.DecodeString(a.Auth)
+
+		if err != nil {
+			return Credential{}, false, errors.Wrapf(err, "invalid auth for %s", k)
+		}
+
+		u, p, ok := strings.Cut(string(buf), ":")
+
+		if !ok {
+			return Credential{}, false, fmt.Errorf("invalid auth for %s", k)
+		}
+
+		return Credential{Username: u, Password: p}, true, nil
+	}
+
+	if h := dc.helper(registry); h != "" {
+		return helperCredential(h, serverKeys(registry)[0])
+	}
+
+	return Credential{}, false, nil
+}
+
+// helperCredential runs docker-credential-<helper> get, as the docker CLI
+// does.
+func helperCredential(helper, server string) (Credential, bool, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String()+stderr.String(), "credentials not found") {
+			return Credential{}, false, nil
+		}
+
+		return Credential{}, false, errors.Wrapf(
+			err,
+			"docker-credential-%s failed: %s",
+			helper,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	var resp struct {
+		Username string
+		Secret   string
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return Credential{}, false, errors.Wrapf(err, "invalid docker-credential-%s output", helper)
+	}
+
+	return Credential{Username: resp.Username, Password: resp.Secret}, true, nil
+}
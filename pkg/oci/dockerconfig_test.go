@@ -0,0 +1,54 @@
+package oci
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerConfigCredential(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(dir, "config.json"),
+			[]byte(`{"auths":{
+  "https://index.docker.io/v1/":{"auth":"Ym90OnNlY3JldA=="},
+  "ghcr.io":{"username":"octocat","password":"token"},
+  "quay.io":{"auth":"bm9wZQ"}
+}}`),
+			0600,
+		),
+	)
+
+	dc, err := LoadDockerConfig(dir)
+	require.NoError(t, err)
+
+	cred, ok, err := dc.Credential("docker.io")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Credential{Username: "bot", Password: "secret"}, cred)
+
+	cred, ok, err = dc.Credential("ghcr.io")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Credential{Username: "octocat", Password: "token"}, cred)
+
+	_, ok, err = dc.Credential("gcr.io")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = dc.Credential("quay.io")
+	assert.Error(t, err)
+
+	dc, err = LoadDockerConfig(t.TempDir())
+	require.NoError(t, err)
+
+	_, ok, err = dc.Credential("docker.io")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
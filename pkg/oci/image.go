@@ -0,0 +1,291 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/upfluence/errors"
+)
+
+// Image is a single platform image: its config and layers.
+type Image struct {
+	Config      ImageConfig
+	Annotations map[string]string
+
+	layers []Blob
+}
+
+func Scratch(p Platform) *Image {
+	return &Image{
+		Config: ImageConfig{
+			OS:           p.OS,
+			Architecture: p.Architecture,
+			Variant:      p.Variant,
+			RootFS:       RootFS{Type: "layers"},
+		},
+	}
+}
+
+// File is a local file copied into a layer.
+type File struct {
+	// Path is the absolute path of the file in the image.
+	Path   string
+	Mode   fs.FileMode
+	Source string
+}
+
+func parentDirs(files []File) []string {
+	var dirs []string
+
+	for _, f := range files {
+		for d := path.Dir(path.Clean("/" + f.Path)); d != "/"; d = path.Dir(d) {
+			if !slices.Contains(dirs, d) {
+				dirs = append(dirs, d)
+			}
+		}
+	}
+
+	slices.Sort(dirs)
+
+	return dirs
+}
+
+func writeLayerFile(tw *tar.Writer, f File, mtime time.Time) error {
+	src, err := os.Open(f.Source)
+
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	fi, err := src.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(
+		&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(path.Clean("/"+f.Path), "/"),
+			Mode:     int64(f.Mode.Perm()),
+			Size:     fi.Size(),
+			ModTime:  mtime,
+		},
+	); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, src)
+
+	return err
+}
+
+// AppendLayer adds a layer holding the given files, along with their parent
+// directories. Every entry is dated at created so the layer digest only
+// depends on the content of the files.
+func (img *Image) AppendLayer(files []File, created time.Time, createdBy string) error {
+	var (
+		buf bytes.Buffer
+
+		diffID = sha256.New()
+		gw     = gzip.NewWriter(&buf)
+		tw     = tar.NewWriter(io.MultiWriter(gw, diffID))
+	)
+
+	created = created.UTC()
+
+	for _, d := range parentDirs(files) {
+		if err := tw.WriteHeader(
+			&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     strings.TrimPrefix(d, "/") + "/",
+				Mode:     0755,
+				ModTime:  created,
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	sorted := slices.Clone(files)
+
+	slices.SortFunc(sorted, func(a, b File) int { return strings.Compare(a.Path, b.Path) })
+
+	for _, f := range sorted {
+		if err := writeLayerFile(tw, f, created); err != nil {
+			return errors.Wrapf(err, "cant add %q to the layer", f.Source)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	img.layers = append(img.layers, BytesBlob(MediaTypeImageLayer, buf.Bytes()))
+
+	img.Config.Created = &created
+	img.Config.RootFS.DiffIDs = append(
+		img.Config.RootFS.DiffIDs,
+		Digest("sha256:"+hex.EncodeToString(diffID.Sum(nil))),
+	)
+	img.Config.History = append(
+		img.Config.History,
+		History{Created: &created, CreatedBy: createdBy},
+	)
+
+	return nil
+}
+
+func (img *Image) Platform() Platform {
+	return img.Config.Platform()
+}
+
+func (img *Image) configBlob() (Blob, error) {
+	buf, err := json.Marshal(img.Config)
+
+	if err != nil {
+		return Blob{}, errors.Wrap(err, "cant marshal the image config")
+	}
+
+	return BytesBlob(MediaTypeImageConfig, buf), nil
+}
+
+func (img *Image) Root() (Blob, error) {
+	cb, err := img.configBlob()
+
+	if err != nil {
+		return Blob{}, err
+	}
+
+	m := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		Config:        cb.Descriptor,
+		Layers:        []Descriptor{},
+		Annotations:   img.Annotations,
+	}
+
+	for _, l := range img.layers {
+		m.Layers = append(m.Layers, l.Descriptor)
+	}
+
+	buf, err := json.Marshal(m)
+
+	if err != nil {
+		return Blob{}, errors.Wrap(err, "cant marshal the image manifest")
+	}
+
+	return BytesBlob(MediaTypeImageManifest, buf), nil
+}
+
+func (img *Image) Blobs() ([]Blob, error) {
+	cb, err := img.configBlob()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]Blob{cb}, img.layers...), nil
+}
+
+// ImageIndex groups images of several platforms under a single reference.
+type ImageIndex struct {
+	Images      []*Image
+	Annotations map[string]string
+}
+
+func (ii ImageIndex) Root() (Blob, error) {
+	idx := Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageIndex,
+		Manifests:     []Descriptor{},
+		Annotations:   ii.Annotations,
+	}
+
+	for _, img := range ii.Images {
+		r, err := img.Root()
+
+		if err != nil {
+			return Blob{}, err
+		}
+
+		p := img.Platform()
+		d := r.Descriptor
+		d.Platform = &p
+
+		idx.Manifests = append(idx.Manifests, d)
+	}
+
+	buf, err := json.Marshal(idx)
+
+	if err != nil {
+		return Blob{}, errors.Wrap(err, "cant marshal the image index")
+	}
+
+	return BytesBlob(MediaTypeImageIndex, buf), nil
+}
+
+func (ii ImageIndex) Blobs() ([]Blob, error) {
+	var bs []Blob
+
+	for _, img := range ii.Images {
+		ibs, err := img.Blobs()
+
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := img.Root()
+
+		if err != nil {
+			return nil, err
+		}
+
+		bs = append(append(bs, ibs...), r)
+	}
+
+	return bs, nil
+}
+
+// RemoteIndex is an index of manifests already pushed to the repository it
+// is pushed to, i.e. images built and pushed per platform by docker.
+type RemoteIndex struct {
+	Manifests   []Descriptor
+	Annotations map[string]string
+}
+
+func (ri RemoteIndex) Root() (Blob, error) {
+	buf, err := json.Marshal(
+		Index{
+			SchemaVersion: 2,
+			MediaType:     MediaTypeImageIndex,
+			Manifests:     ri.Manifests,
+			Annotations:   ri.Annotations,
+		},
+	)
+
+	if err != nil {
+		return Blob{}, errors.Wrap(err, "cant marshal the image index")
+	}
+
+	return BytesBlob(MediaTypeImageIndex, buf), nil
+}
+
+func (RemoteIndex) Blobs() ([]Blob, error) { return nil, nil }
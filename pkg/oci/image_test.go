@@ -0,0 +1,155 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readBlob(t testing.TB, b Blob) []byte {
+	r, err := b.Open()
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	buf, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return buf
+}
+
+func testImage(t testing.TB, p Platform, body string) *Image {
+	fname := filepath.Join(t.TempDir(), "foo")
+	require.NoError(t, os.WriteFile(fname, []byte(body), 0644))
+
+	img := Scratch(p)
+	img.Config.Config.Entrypoint = []string{"/usr/local/bin/foo"}
+
+	require.NoError(
+		t,
+		img.AppendLayer(
+			[]File{{Path: "/usr/local/bin/foo", Mode: 0755, Source: fname}},
+			time.Unix(1700000000, 0),
+			"COPY foo /usr/local/bin/foo",
+		),
+	)
+
+	return img
+}
+
+func TestImageAppendLayer(t *testing.T) {
+	img := testImage(t, Platform{OS: "linux", Architecture: "amd64"}, "#!/bin/sh\n")
+
+	bs, err := img.Blobs()
+	require.NoError(t, err)
+	require.Len(t, bs, 2)
+
+	layer := readBlob(t, bs[1])
+	assert.Equal(t, DigestOf(layer), bs[1].Descriptor.Digest)
+
+	gr, err := gzip.NewReader(bytes.NewReader(layer))
+	require.NoError(t, err)
+
+	raw, err := io.ReadAll(gr)
+	require.NoError(t, err)
+
+	diffID := sha256.Sum256(raw)
+	assert.Equal(
+		t,
+		[]Digest{Digest("sha256:" + hex.EncodeToString(diffID[:]))},
+		img.Config.RootFS.DiffIDs,
+	)
+
+	var (
+		names []string
+		modes []int64
+
+		tr = tar.NewReader(bytes.NewReader(raw))
+	)
+
+	for {
+		h, err := tr.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+
+		names = append(names, h.Name)
+		modes = append(modes, h.Mode)
+	}
+
+	assert.Equal(t, []string{"usr/", "usr/local/", "usr/local/bin/", "usr/local/bin/foo"}, names)
+	assert.Equal(t, []int64{0755, 0755, 0755, 0755}, modes)
+
+	var cfg ImageConfig
+
+	require.NoError(t, json.Unmarshal(readBlob(t, bs[0]), &cfg))
+	assert.Equal(t, []string{"/usr/local/bin/foo"}, cfg.Config.Entrypoint)
+	assert.Equal(t, "amd64", cfg.Architecture)
+	assert.Len(t, cfg.History, 1)
+
+	// the same inputs produce the same image
+	r1, err := img.Root()
+	require.NoError(t, err)
+
+	r2, err := testImage(t, Platform{OS: "linux", Architecture: "amd64"}, "#!/bin/sh\n").Root()
+	require.NoError(t, err)
+
+	assert.Equal(t, r1.Descriptor.Digest, r2.Descriptor.Digest)
+}
+
+func TestImageIndex(t *testing.T) {
+	ii := ImageIndex{
+		Images: []*Image{
+			testImage(t, Platform{OS: "linux", Architecture: "amd64"}, "amd64"),
+			testImage(t, Platform{OS: "linux", Architecture: "arm64"}, "arm64"),
+		},
+	}
+
+	root, err := ii.Root()
+	require.NoError(t, err)
+
+	var idx Index
+
+	require.NoError(t, json.Unmarshal(readBlob(t, root), &idx))
+	require.Len(t, idx.Manifests, 2)
+
+	assert.Equal(t, MediaTypeImageIndex, idx.MediaType)
+	assert.Equal(t, "linux/amd64", idx.Manifests[0].Platform.String())
+	assert.Equal(t, "linux/arm64", idx.Manifests[1].Platform.String())
+
+	bs, err := ii.Blobs()
+	require.NoError(t, err)
+	require.Len(t, bs, 6)
+
+	// manifests come after the blobs they reference
+	assert.Equal(t, idx.Manifests[0].Digest, bs[2].Descriptor.Digest)
+	assert.Equal(t, idx.Manifests[1].Digest, bs[5].Descriptor.Digest)
+}
+
+func TestParsePlatform(t *testing.T) {
+	p, err := ParsePlatform("linux/arm/v7")
+	require.NoError(t, err)
+
+	assert.Equal(t, Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, p)
+	assert.True(t, p.Match(Platform{OS: "linux", Architecture: "arm"}))
+	assert.False(t, p.Match(Platform{OS: "linux", Architecture: "arm", Variant: "v6"}))
+
+	for _, v := range []string{"linux", "linux/", "linux/arm/v7/x"} {
+		_, err := ParsePlatform(v)
+		assert.Error(t, err, v)
+	}
+}
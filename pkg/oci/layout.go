@@ -0,0 +1,300 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/upfluence/errors"
+)
+
+const (
+	layoutFile    = "oci-layout"
+	layoutIndex   = "index.json"
+	layoutVersion = "1.0.0"
+
+	// annotationImageName names the images loaded by docker and containerd.
+	annotationImageName = "io.containerd.image.name"
+)
+
+var ErrPlatformNotFound = errors.New("no image matches the platform")
+
+type layoutMarker struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+// Layout is an OCI image layout directory, as written by skopeo copy or
+// docker buildx --output type=oci.
+type Layout struct {
+	dir   string
+	index Index
+}
+
+func ReadLayout(dir string) (*Layout, error) {
+	var lm layoutMarker
+
+	if err := readJSONFile(filepath.Join(dir, layoutFile), &lm); err != nil {
+		return nil, errors.Wrapf(err, "%q is not an OCI layout", dir)
+	}
+
+	if lm.ImageLayoutVersion != layoutVersion {
+		return nil, fmt.Errorf("unsupported OCI layout version %q", lm.ImageLayoutVersion)
+	}
+
+	l := Layout{dir: dir}
+
+	if err := readJSONFile(filepath.Join(dir, layoutIndex), &l.index); err != nil {
+		return nil, errors.Wrapf(err, "cant read the index of %q", dir)
+	}
+
+	return &l, nil
+}
+
+func readJSONFile(fname string, v any) error {
+	buf, err := os.ReadFile(fname)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+}
+
+func (l *Layout) blobPath(d Digest) string {
+	return filepath.Join(l.dir, "blobs", "sha256", d.Hex())
+}
+
+func (l *Layout) blob(d Descriptor) Blob {
+	fname := l.blobPath(d.Digest)
+
+	return Blob{
+		Descriptor: d,
+		open: func() (io.ReadCloser, error) {
+			return os.Open(fname)
+		},
+	}
+}
+
+// readJSON decodes a manifest, an index or a config after checking it
+// matches its digest.
+func (l *Layout) readJSON(d Descriptor, v any) error {
+	if err := d.Digest.Validate(); err != nil {
+		return err
+	}
+
+	buf, err := os.ReadFile(l.blobPath(d.Digest))
+
+	if err != nil {
+		return err
+	}
+
+	if got := DigestOf(buf); got != d.Digest {
+		return fmt.Errorf("blob %s is corrupted, its digest is %s", d.Digest, got)
+	}
+
+	return json.Unmarshal(buf, v)
+}
+
+// Image returns the image of the given platform. ref selects a manifest of
+// the layout by its org.opencontainers.image.ref.name annotation, every
+// manifest is considered when empty.
+func (l *Layout) Image(ref string, p Platform) (*Image, error) {
+	var found bool
+
+	for _, d := range l.index.Manifests {
+		if ref != "" && d.Annotations[AnnotationRefName] != ref {
+			continue
+		}
+
+		found = true
+
+		img, err := l.resolve(d, p)
+
+		if errors.Is(err, ErrPlatformNotFound) {
+			continue
+		}
+
+		return img, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no manifest is named %q in %q", ref, l.dir)
+	}
+
+	return nil, errors.Wrapf(ErrPlatformNotFound, "cant find %s in %q", p, l.dir)
+}
+
+func (l *Layout) resolve(d Descriptor, p Platform) (*Image, error) {
+	if d.Platform != nil && !d.Platform.Match(p) {
+		return nil, ErrPlatformNotFound
+	}
+
+	if IsIndex(d.MediaType) {
+		var idx Index
+
+		if err := l.readJSON(d, &idx); err != nil {
+			return nil, errors.Wrapf(err, "cant read index %s", d.Digest)
+		}
+
+		for _, cd := range idx.Manifests {
+			img, err := l.resolve(cd, p)
+
+			if errors.Is(err, ErrPlatformNotFound) {
+				continue
+			}
+
+			return img, err
+		}
+
+		return nil, ErrPlatformNotFound
+	}
+
+	if !isManifest(d.MediaType) {
+		return nil, fmt.Errorf("unsupported media type %q", d.MediaType)
+	}
+
+	var m Manifest
+
+	if err := l.readJSON(d, &m); err != nil {
+		return nil, errors.Wrapf(err, "cant read manifest %s", d.Digest)
+	}
+
+	img := Image{Annotations: m.Annotations}
+
+	if err := l.readJSON(m.Config, &img.Config); err != nil {
+		return nil, errors.Wrapf(err, "cant read config %s", m.Config.Digest)
+	}
+
+	if !img.Platform().Match(p) {
+		return nil, ErrPlatformNotFound
+	}
+
+	for _, ld := range m.Layers {
+		if _, err := os.Stat(l.blobPath(ld.Digest)); err != nil {
+			return nil, errors.Wrapf(err, "layer %s is missing", ld.Digest)
+		}
+
+		img.layers = append(img.layers, l.blob(ld))
+	}
+
+	return &img, nil
+}
+
+// layoutTime dates the entries of layout tarballs so they are reproducible.
+var layoutTime = time.Unix(0, 0).UTC()
+
+func writeTarFile(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(
+		&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     size,
+			ModTime:  layoutTime,
+		},
+	); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(tw, r)
+
+	return err
+}
+
+func writeTarBlob(tw *tar.Writer, b Blob) error {
+	r, err := b.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	return writeTarFile(
+		tw,
+		"blobs/sha256/"+b.Descriptor.Digest.Hex(),
+		b.Descriptor.Size,
+		r,
+	)
+}
+
+// WriteLayout writes c as an OCI layout tarball, loadable by docker load or
+// skopeo. The root is referenced once per ref in index.json.
+func WriteLayout(w io.Writer, c Content, refs ...Reference) error {
+	bs, err := c.Blobs()
+
+	if err != nil {
+		return err
+	}
+
+	root, err := c.Root()
+
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+
+	buf, err := json.Marshal(layoutMarker{ImageLayoutVersion: layoutVersion})
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeTarFile(tw, layoutFile, int64(len(buf)), bytes.NewReader(buf)); err != nil {
+		return err
+	}
+
+	for _, d := range []string{"blobs/", "blobs/sha256/"} {
+		if err := tw.WriteHeader(
+			&tar.Header{Typeflag: tar.TypeDir, Name: d, Mode: 0755, ModTime: layoutTime},
+		); err != nil {
+			return err
+		}
+	}
+
+	written := make(map[Digest]bool)
+
+	for _, b := range append(bs, root) {
+		if written[b.Descriptor.Digest] {
+			continue
+		}
+
+		if err := writeTarBlob(tw, b); err != nil {
+			return errors.Wrapf(err, "cant write blob %s", b.Descriptor.Digest)
+		}
+
+		written[b.Descriptor.Digest] = true
+	}
+
+	idx := Index{SchemaVersion: 2, MediaType: MediaTypeImageIndex}
+
+	for _, ref := range refs {
+		d := root.Descriptor
+		d.Annotations = map[string]string{
+			AnnotationRefName:   ref.Tag,
+			annotationImageName: ref.String(),
+		}
+
+		idx.Manifests = append(idx.Manifests, d)
+	}
+
+	if len(refs) == 0 {
+		idx.Manifests = []Descriptor{root.Descriptor}
+	}
+
+	if buf, err = json.Marshal(idx); err != nil {
+		return err
+	}
+
+	if err := writeTarFile(tw, layoutIndex, int64(len(buf)), bytes.NewReader(buf)); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
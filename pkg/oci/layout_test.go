@@ -0,0 +1,156 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func extractLayout(t testing.TB, buf []byte) string {
+	var (
+		dir = t.TempDir()
+		tr  = tar.NewReader(bytes.NewReader(buf))
+	)
+
+	for {
+		h, err := tr.Next()
+
+		if err == io.EOF {
+			return dir
+		}
+
+		require.NoError(t, err)
+
+		target := filepath.Join(dir, filepath.FromSlash(h.Name))
+
+		if h.Typeflag == tar.TypeDir {
+			require.NoError(t, os.MkdirAll(target, 0755))
+			continue
+		}
+
+		body, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(target, body, 0644))
+	}
+}
+
+func TestWriteLayout(t *testing.T) {
+	var (
+		buf bytes.Buffer
+
+		ii = ImageIndex{
+			Images: []*Image{
+				testImage(t, Platform{OS: "linux", Architecture: "amd64"}, "amd64"),
+				testImage(t, Platform{OS: "linux", Architecture: "arm64"}, "arm64"),
+			},
+		}
+	)
+
+	ref, err := ParseReference("ghcr.io/upfluence/foo")
+	require.NoError(t, err)
+
+	require.NoError(t, WriteLayout(&buf, ii, ref.WithTag("v1.0.0"), ref.WithTag("latest")))
+
+	dir := extractLayout(t, buf.Bytes())
+
+	var idx Index
+
+	require.NoError(t, readJSONFile(filepath.Join(dir, "index.json"), &idx))
+	require.Len(t, idx.Manifests, 2)
+	assert.Equal(t, "v1.0.0", idx.Manifests[0].Annotations[AnnotationRefName])
+	assert.Equal(t, "latest", idx.Manifests[1].Annotations[AnnotationRefName])
+	assert.Equal(t, "ghcr.io/upfluence/foo:latest", idx.Manifests[1].Annotations[annotationImageName])
+
+	l, err := ReadLayout(dir)
+	require.NoError(t, err)
+
+	img, err := l.Image("latest", Platform{OS: "linux", Architecture: "arm64"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "arm64", img.Config.Architecture)
+	assert.Equal(t, []string{"/usr/local/bin/foo"}, img.Config.Config.Entrypoint)
+
+	want, err := ii.Images[1].Root()
+	require.NoError(t, err)
+
+	got, err := img.Root()
+	require.NoError(t, err)
+
+	assert.Equal(t, want.Descriptor.Digest, got.Descriptor.Digest)
+
+	_, err = l.Image("", Platform{OS: "linux", Architecture: "s390x"})
+	assert.ErrorIs(t, err, ErrPlatformNotFound)
+
+	_, err = l.Image("v2.0.0", Platform{OS: "linux", Architecture: "amd64"})
+	assert.Error(t, err)
+}
+
+func TestLayoutBaseImage(t *testing.T) {
+	var buf bytes.Buffer
+
+	require.NoError(
+		t,
+		WriteLayout(&buf, testImage(t, Platform{OS: "linux", Architecture: "amd64"}, "base")),
+	)
+
+	l, err := ReadLayout(extractLayout(t, buf.Bytes()))
+	require.NoError(t, err)
+
+	img, err := l.Image("", Platform{OS: "linux", Architecture: "amd64"})
+	require.NoError(t, err)
+
+	fname := filepath.Join(t.TempDir(), "bar")
+	require.NoError(t, os.WriteFile(fname, []byte("bar"), 0644))
+
+	require.NoError(
+		t,
+		img.AppendLayer(
+			[]File{{Path: "/bar", Mode: 0755, Source: fname}},
+			time.Unix(1700000000, 0),
+			"COPY bar /bar",
+		),
+	)
+
+	bs, err := img.Blobs()
+	require.NoError(t, err)
+	require.Len(t, bs, 3)
+
+	// the base layer is served from the layout
+	assert.Equal(t, DigestOf(readBlob(t, bs[1])), bs[1].Descriptor.Digest)
+	assert.Len(t, img.Config.RootFS.DiffIDs, 2)
+	assert.Len(t, img.Config.History, 2)
+}
+
+func TestReadLayoutCorruptedBlob(t *testing.T) {
+	var buf bytes.Buffer
+
+	img := testImage(t, Platform{OS: "linux", Architecture: "amd64"}, "base")
+
+	require.NoError(t, WriteLayout(&buf, img))
+
+	dir := extractLayout(t, buf.Bytes())
+	root, err := img.Root()
+	require.NoError(t, err)
+
+	var m Manifest
+
+	require.NoError(t, json.Unmarshal(readBlob(t, root), &m))
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, "blobs", "sha256", m.Config.Digest.Hex()), []byte("{}"), 0644),
+	)
+
+	l, err := ReadLayout(dir)
+	require.NoError(t, err)
+
+	_, err = l.Image("", Platform{OS: "linux", Architecture: "amd64"})
+	assert.ErrorContains(t, err, "corrupted")
+}
@@ -0,0 +1,214 @@
+// Package oci assembles, stores and pushes OCI images without relying on a
+// container runtime.
+package oci
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	MediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeImageConfig   = "application/vnd.oci.image.config.v1+json"
+	MediaTypeImageLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// docker media types, found in layouts copied from docker registries
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+
+	AnnotationRefName  = "org.opencontainers.image.ref.name"
+	AnnotationCreated  = "org.opencontainers.image.created"
+	AnnotationSource   = "org.opencontainers.image.source"
+	AnnotationRevision = "org.opencontainers.image.revision"
+	AnnotationVersion  = "org.opencontainers.image.version"
+	AnnotationTitle    = "org.opencontainers.image.title"
+	AnnotationLicenses = "org.opencontainers.image.licenses"
+	AnnotationURL      = "org.opencontainers.image.url"
+)
+
+// IsIndex reports whether mt is the media type of an OCI index or a docker
+// manifest list.
+func IsIndex(mt string) bool {
+	return mt == MediaTypeImageIndex || mt == mediaTypeDockerManifestList
+}
+
+func isManifest(mt string) bool {
+	return mt == MediaTypeImageManifest || mt == mediaTypeDockerManifest || IsIndex(mt)
+}
+
+type Digest string
+
+func DigestOf(buf []byte) Digest {
+	sum := sha256.Sum256(buf)
+
+	return Digest("sha256:" + hex.EncodeToString(sum[:]))
+}
+
+var digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+func (d Digest) Validate() error {
+	if !digestRegexp.MatchString(string(d)) {
+		return fmt.Errorf("invalid digest %q", d)
+	}
+
+	return nil
+}
+
+// Hex returns the encoded part of the digest, naming the blob in a layout.
+func (d Digest) Hex() string {
+	_, h, _ := strings.Cut(string(d), ":")
+
+	return h
+}
+
+func (d Digest) String() string { return string(d) }
+
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ParsePlatform parses a os/arch[/variant] platform, as docker does.
+func ParsePlatform(v string) (Platform, error) {
+	ps := strings.Split(v, "/")
+
+	if len(ps) < 2 || len(ps) > 3 || ps[0] == "" || ps[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q, os/arch[/variant] expected", v)
+	}
+
+	p := Platform{OS: ps[0], Architecture: ps[1]}
+
+	if len(ps) == 3 {
+		p.Variant = ps[2]
+	}
+
+	return p, nil
+}
+
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+
+	return s
+}
+
+// Match reports whether p satisfies the requested platform, a missing
+// variant matches any variant.
+func (p Platform) Match(want Platform) bool {
+	return p.OS == want.OS &&
+		p.Architecture == want.Architecture &&
+		(want.Variant == "" || p.Variant == want.Variant)
+}
+
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      Digest            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ContainerConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+}
+
+type RootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []Digest `json:"diff_ids"`
+}
+
+type History struct {
+	Created    *time.Time `json:"created,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	EmptyLayer bool       `json:"empty_layer,omitempty"`
+}
+
+type ImageConfig struct {
+	Created      *time.Time      `json:"created,omitempty"`
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Variant      string          `json:"variant,omitempty"`
+	Config       ContainerConfig `json:"config"`
+	RootFS       RootFS          `json:"rootfs"`
+	History      []History       `json:"history,omitempty"`
+}
+
+func (ic ImageConfig) Platform() Platform {
+	return Platform{OS: ic.OS, Architecture: ic.Architecture, Variant: ic.Variant}
+}
+
+// Blob is a content addressed piece of an image, opened on demand so layers
+// are not held in memory when read from a layout.
+type Blob struct {
+	Descriptor Descriptor
+
+	open func() (io.ReadCloser, error)
+}
+
+func (b Blob) Open() (io.ReadCloser, error) {
+	return b.open()
+}
+
+func BytesBlob(mediaType string, buf []byte) Blob {
+	return Blob{
+		Descriptor: Descriptor{MediaType: mediaType, Digest: DigestOf(buf), Size: int64(len(buf))},
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(buf)), nil
+		},
+	}
+}
+
+// Content is a tree of blobs rooted at an image manifest or an index.
+type Content interface {
+	// Root returns the top level manifest or index.
+	Root() (Blob, error)
+
+	// Blobs returns the blobs referenced by the root, children first so they
+	// can be pushed in order.
+	Blobs() ([]Blob, error)
+}
+
+var tagRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+func ValidateTag(t string) error {
+	if !tagRegexp.MatchString(t) {
+		return fmt.Errorf("invalid tag %q", t)
+	}
+
+	return nil
+}
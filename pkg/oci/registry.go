@@ -0,0 +1,547 @@
+package oci
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/upfluence/errors"
+)
+
+const (
+	dockerHub     = "docker.io"
+	dockerHubHost = "registry-1.docker.io"
+)
+
+// dockerHubAliases are the other names docker hub is known by.
+var dockerHubAliases = []string{"index.docker.io", dockerHubHost}
+
+var repositoryRegexp = regexp.MustCompile(
+	`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`,
+)
+
+// Reference locates a repository, and optionally a tag, in a registry.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// ParseReference parses references the way docker does: the registry
+// defaults to docker.io and official images live under library/.
+func ParseReference(v string) (Reference, error) {
+	var r Reference
+
+	if strings.Contains(v, "@") {
+		return r, fmt.Errorf("invalid reference %q, digests are not supported", v)
+	}
+
+	name := v
+
+	if i := strings.LastIndex(v, ":"); i > strings.LastIndex(v, "/") {
+		name, r.Tag = v[:i], v[i+1:]
+
+		if err := ValidateTag(r.Tag); err != nil {
+			return r, err
+		}
+	}
+
+	host, rest, ok := strings.Cut(name, "/")
+
+	if ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		r.Registry, r.Repository = host, rest
+
+		if slices.Contains(dockerHubAliases, host) {
+			r.Registry = dockerHub
+		}
+	} else {
+		r.Registry, r.Repository = dockerHub, name
+	}
+
+	if r.Registry == dockerHub && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+
+	if !repositoryRegexp.MatchString(r.Repository) {
+		return r, fmt.Errorf("invalid repository name %q", r.Repository)
+	}
+
+	return r, nil
+}
+
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+
+	return s
+}
+
+func (r Reference) WithTag(t string) Reference {
+	r.Tag = t
+
+	return r
+}
+
+func (r Reference) host() string {
+	if r.Registry == dockerHub {
+		return dockerHubHost
+	}
+
+	return r.Registry
+}
+
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Keychain looks up the credential of a registry, ok is false when the
+// registry should be accessed anonymously.
+type Keychain interface {
+	Credential(registry string) (cred Credential, ok bool, err error)
+}
+
+// Client pushes content to registries implementing the OCI distribution
+// API.
+type Client struct {
+	HTTPClient *http.Client
+
+	// Credentials are indexed by registry, i.e. ghcr.io or docker.io, and
+	// take precedence over the keychain.
+	Credentials map[string]Credential
+	Keychain    Keychain
+
+	// PlainHTTP talks to registries over http, for local registries.
+	PlainHTTP bool
+
+	mu sync.Mutex
+	// authorizations caches the Authorization header per repository.
+	authorizations map[string]string
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+func (c *Client) url(r Reference, p string) string {
+	scheme := "https"
+
+	if c.PlainHTTP {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, r.host(), r.Repository, p)
+}
+
+// Push uploads every blob of c to the repository of r, then tags the root
+// with the tag of r and the additional tags.
+func (c *Client) Push(ctx context.Context, r Reference, content Content, tags ...string) (Descriptor, error) {
+	bs, err := content.Blobs()
+
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	root, err := content.Root()
+
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	pushed := make(map[Digest]bool)
+
+	for _, b := range bs {
+		if pushed[b.Descriptor.Digest] {
+			continue
+		}
+
+		if isManifest(b.Descriptor.MediaType) {
+			err = c.putManifest(ctx, r, b.Descriptor.Digest.String(), b)
+		} else {
+			err = c.pushBlob(ctx, r, b)
+		}
+
+		if err != nil {
+			return Descriptor{}, errors.Wrapf(err, "cant push %s to %s", b.Descriptor.Digest, r)
+		}
+
+		pushed[b.Descriptor.Digest] = true
+	}
+
+	if r.Tag != "" {
+		tags = append([]string{r.Tag}, tags...)
+	}
+
+	if len(tags) == 0 {
+		tags = []string{root.Descriptor.Digest.String()}
+	}
+
+	for _, t := range tags {
+		if err := c.putManifest(ctx, r, t, root); err != nil {
+			return Descriptor{}, errors.Wrapf(err, "cant push %s", r.WithTag(t))
+		}
+	}
+
+	return root.Descriptor, nil
+}
+
+var manifestMediaTypes = []string{
+	MediaTypeImageIndex,
+	MediaTypeImageManifest,
+	mediaTypeDockerManifestList,
+	mediaTypeDockerManifest,
+}
+
+func (c *Client) Resolve(ctx context.Context, r Reference) (Descriptor, []byte, error) {
+	ref := r.Tag
+
+	if ref == "" {
+		ref = "latest"
+	}
+
+	resp, err := c.do(
+		ctx,
+		r,
+		http.MethodGet,
+		c.url(r, "manifests/"+ref),
+		nil,
+		map[string]string{"Accept": strings.Join(manifestMediaTypes, ", ")},
+	)
+
+	if err != nil {
+		return Descriptor{}, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return Descriptor{}, nil, errors.Wrapf(err, "cant resolve %s", r)
+	}
+
+	buf, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return Descriptor{}, nil, err
+	}
+
+	mt, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+
+	return Descriptor{MediaType: mt, Digest: DigestOf(buf), Size: int64(len(buf))}, buf, nil
+}
+
+// Index resolves r and returns the manifests of the index it points to,
+// along with their platforms.
+func (c *Client) Index(ctx context.Context, r Reference) (Descriptor, Index, error) {
+	d, buf, err := c.Resolve(ctx, r)
+
+	if err != nil {
+		return d, Index{}, err
+	}
+
+	if !IsIndex(d.MediaType) {
+		return d, Index{}, fmt.Errorf("%s is not an index but a %q", r, d.MediaType)
+	}
+
+	var idx Index
+
+	if err := json.Unmarshal(buf, &idx); err != nil {
+		return d, idx, errors.Wrapf(err, "cant decode the index of %s", r)
+	}
+
+	return d, idx, nil
+}
+
+func (c *Client) pushBlob(ctx context.Context, r Reference, b Blob) error {
+	resp, err := c.do(ctx, r, http.MethodHead, c.url(r, "blobs/"+b.Descriptor.Digest.String()), nil, nil)
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = c.do(ctx, r, http.MethodPost, c.url(r, "blobs/uploads/"), nil, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusAccepted); err != nil {
+		return errors.Wrap(err, "cant start the upload")
+	}
+
+	loc, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+
+	if err != nil {
+		return errors.Wrap(err, "invalid upload location")
+	}
+
+	q := loc.Query()
+	q.Set("digest", b.Descriptor.Digest.String())
+	loc.RawQuery = q.Encode()
+
+	resp, err = c.do(ctx, r, http.MethodPut, loc.String(), &b, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return checkStatus(resp, http.StatusCreated)
+}
+
+func (c *Client) putManifest(ctx context.Context, r Reference, ref string, b Blob) error {
+	resp, err := c.do(ctx, r, http.MethodPut, c.url(r, "manifests/"+ref), &b, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return checkStatus(resp, http.StatusCreated, http.StatusOK)
+}
+
+func checkStatus(resp *http.Response, codes ...int) error {
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+
+	buf, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	return fmt.Errorf(
+		"%s %s: %s %s",
+		resp.Request.Method,
+		resp.Request.URL.Redacted(),
+		resp.Status,
+		strings.TrimSpace(string(buf)),
+	)
+}
+
+func (c *Client) newRequest(ctx context.Context, method, u string, b *Blob) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if b != nil {
+		body, err := b.Open()
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = body
+		req.ContentLength = b.Descriptor.Size
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		if isManifest(b.Descriptor.MediaType) {
+			req.Header.Set("Content-Type", b.Descriptor.MediaType)
+		}
+	}
+
+	return req, nil
+}
+
+// do sends the request, authenticating against the challenge returned by
+// the registry and retrying once on 401.
+func (c *Client) do(ctx context.Context, r Reference, method, u string, b *Blob, headers map[string]string) (*http.Response, error) {
+	key := r.Registry + "/" + r.Repository
+
+	for retry := 0; ; retry++ {
+		req, err := c.newRequest(ctx, method, u, b)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		c.mu.Lock()
+		auth := c.authorizations[key]
+		c.mu.Unlock()
+
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		resp, err := c.httpClient().Do(req)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized || retry > 0 {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+
+		if auth, err = c.authorize(ctx, r, resp.Header.Get("WWW-Authenticate")); err != nil {
+			return nil, errors.Wrapf(err, "cant authenticate against %s", r.Registry)
+		}
+
+		c.mu.Lock()
+
+		if c.authorizations == nil {
+			c.authorizations = make(map[string]string)
+		}
+
+		c.authorizations[key] = auth
+		c.mu.Unlock()
+	}
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// Bearer realm="https://ghcr.io/token",service="ghcr.io".
+func parseChallenge(v string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(v), " ")
+	params := make(map[string]string)
+
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		k, tail, ok := strings.Cut(rest, "=")
+
+		if !ok {
+			break
+		}
+
+		var val string
+
+		if strings.HasPrefix(tail, `"`) {
+			end := strings.Index(tail[1:], `"`)
+
+			if end < 0 {
+				break
+			}
+
+			val, tail = tail[1:end+1], tail[end+2:]
+		} else {
+			val, tail, _ = strings.Cut(tail, ",")
+			tail = "," + tail
+		}
+
+		params[strings.ToLower(strings.TrimSpace(k))] = val
+		rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tail), ","))
+	}
+
+	return strings.ToLower(scheme), params
+}
+
+func (c *Client) credential(registry string) (Credential, bool, error) {
+	if cred, ok := c.Credentials[registry]; ok {
+		return cred, true, nil
+	}
+
+	if c.Keychain == nil {
+		return Credential{}, false, nil
+	}
+
+	return c.Keychain.Credential(registry)
+}
+
+func (c *Client) authorize(ctx context.Context, r Reference, challenge string) (string, error) {
+	cred, hasCred, err := c.credential(r.Registry)
+
+	if err != nil {
+		return "", errors.Wrapf(err, "cant lookup the credentials of %s", r.Registry)
+	}
+
+	scheme, params := parseChallenge(challenge)
+
+	switch scheme {
+	case "basic":
+		if !hasCred {
+			return "", errors.New("no credentials configured")
+		}
+
+		return "Basic " + base64.StdEncoding.EncodeToString(
+			[]byte(cred.Username+":"+cred.Password),
+		), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported challenge %q", challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid realm in challenge %q", challenge)
+	}
+
+	q := realm.Query()
+
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+
+	q.Set("scope", fmt.Sprintf("repository:%s:pull,push", r.Repository))
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	if hasCred {
+		req.SetBasicAuth(cred.Username, cred.Password)
+	}
+
+	resp, err := c.httpClient().Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	var tr struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", errors.Wrap(err, "cant decode the token response")
+	}
+
+	if tr.Token == "" {
+		tr.Token = tr.AccessToken
+	}
+
+	if tr.Token == "" {
+		return "", errors.New("the token response holds no token")
+	}
+
+	return "Bearer " + tr.Token, nil
+}
@@ -0,0 +1,218 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRegistry struct {
+	mu sync.Mutex
+
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	types     map[string]string
+	uploads   int
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+	}
+}
+
+func (fr *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		if u, p, ok := r.BasicAuth(); !ok || u != "bot" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fmt.Fprint(w, `{"token":"tok"}`)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer tok" {
+		w.Header().Set(
+			"WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="http://%s/token",service="fake",scope="repository:foo/bar:pull"`, r.Host),
+		)
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	p := strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/")
+
+	switch {
+	case r.Method == http.MethodHead && strings.HasPrefix(p, "blobs/"):
+		if _, ok := fr.blobs[strings.TrimPrefix(p, "blobs/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPost && p == "blobs/uploads/":
+		w.Header().Set("Location", "/v2/foo/bar/blobs/uploads/1?state=x")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && strings.HasPrefix(p, "blobs/uploads/"):
+		buf, _ := io.ReadAll(r.Body)
+		d := r.URL.Query().Get("digest")
+
+		if r.URL.Query().Get("state") != "x" || DigestOf(buf).String() != d {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		fr.uploads++
+		fr.blobs[d] = buf
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && strings.HasPrefix(p, "manifests/"):
+		buf, _ := io.ReadAll(r.Body)
+
+		if !isManifest(r.Header.Get("Content-Type")) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		fr.manifests[strings.TrimPrefix(p, "manifests/")] = buf
+		fr.types[strings.TrimPrefix(p, "manifests/")] = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && strings.HasPrefix(p, "manifests/"):
+		ref := strings.TrimPrefix(p, "manifests/")
+		buf, ok := fr.manifests[ref]
+
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", fr.types[ref])
+		w.Write(buf)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestClientPush(t *testing.T) {
+	fr := newFakeRegistry()
+	srv := httptest.NewServer(fr)
+
+	defer srv.Close()
+
+	ref, err := ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/foo/bar:v1.0.0")
+	require.NoError(t, err)
+
+	var (
+		ii = ImageIndex{
+			Images: []*Image{
+				testImage(t, Platform{OS: "linux", Architecture: "amd64"}, "amd64"),
+				testImage(t, Platform{OS: "linux", Architecture: "arm64"}, "arm64"),
+			},
+		}
+
+		c = Client{
+			PlainHTTP:   true,
+			Credentials: map[string]Credential{ref.Registry: {Username: "bot", Password: "secret"}},
+		}
+	)
+
+	d, err := c.Push(context.Background(), ref, ii, "latest")
+	require.NoError(t, err)
+
+	assert.Equal(t, MediaTypeImageIndex, d.MediaType)
+	assert.Equal(t, 4, fr.uploads)
+
+	for _, tag := range []string{"v1.0.0", "latest"} {
+		assert.Equal(t, d.Digest, DigestOf(fr.manifests[tag]), tag)
+	}
+
+	var idx Index
+
+	require.NoError(t, json.Unmarshal(fr.manifests["v1.0.0"], &idx))
+
+	for _, md := range idx.Manifests {
+		assert.Contains(t, fr.manifests, md.Digest.String())
+	}
+
+	// blobs already in the registry are not uploaded again
+	_, err = c.Push(context.Background(), ref, ii)
+	require.NoError(t, err)
+	assert.Equal(t, 4, fr.uploads)
+
+	// the index can be assembled again out of the pushed manifests
+	rd, ridx, err := c.Index(context.Background(), ref.WithTag("latest"))
+	require.NoError(t, err)
+	assert.Equal(t, d, rd)
+	assert.Equal(t, idx.Manifests, ridx.Manifests)
+
+	d2, err := c.Push(context.Background(), ref.WithTag("v1.0"), RemoteIndex{Manifests: ridx.Manifests})
+	require.NoError(t, err)
+	assert.Equal(t, d.Digest, d2.Digest)
+
+	_, _, err = c.Index(context.Background(), ref.WithTag(idx.Manifests[0].Digest.String()))
+	assert.ErrorContains(t, err, "is not an index")
+
+	c = Client{PlainHTTP: true}
+
+	_, err = c.Push(context.Background(), ref, ii)
+	assert.Error(t, err)
+}
+
+func TestParseReference(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    Reference
+		wantErr bool
+	}{
+		{in: "alpine", want: Reference{Registry: "docker.io", Repository: "library/alpine"}},
+		{in: "index.docker.io/upfluence/foo", want: Reference{Registry: "docker.io", Repository: "upfluence/foo"}},
+		{in: "upfluence/foo:v1", want: Reference{Registry: "docker.io", Repository: "upfluence/foo", Tag: "v1"}},
+		{in: "ghcr.io/upfluence/foo", want: Reference{Registry: "ghcr.io", Repository: "upfluence/foo"}},
+		{in: "localhost:5000/foo:latest", want: Reference{Registry: "localhost:5000", Repository: "foo", Tag: "latest"}},
+		{in: "ghcr.io/Upfluence/foo", wantErr: true},
+		{in: "foo:v1+build", wantErr: true},
+		{in: "foo@sha256:abc", wantErr: true},
+	} {
+		r, err := ParseReference(tt.in)
+
+		if tt.wantErr {
+			assert.Error(t, err, tt.in)
+			continue
+		}
+
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, r, tt.in)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:a/b:pull,push"`)
+
+	assert.Equal(t, "bearer", scheme)
+	assert.Equal(
+		t,
+		map[string]string{
+			"realm":   "https://ghcr.io/token",
+			"service": "ghcr.io",
+			"scope":   "repository:a/b:pull,push",
+		},
+		params,
+	)
+
+	scheme, params = parseChallenge(`Basic realm=registry`)
+
+	assert.Equal(t, "basic", scheme)
+	assert.Equal(t, map[string]string{"realm": "registry"}, params)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -22,10 +23,34 @@ type Title string
 func (t Title) GetKey() string   { return "title" }
 func (t Title) GetValue() string { return string(t) }
 
+// File and Line point the annotation to a location of the repository
+// instead of the caller of the logger.
+type File string
+
+func (f File) GetKey() string   { return "file" }
+func (f File) GetValue() string { return string(f) }
+
+type Line int
+
+func (l Line) GetKey() string   { return "line" }
+func (l Line) GetValue() string { return strconv.Itoa(int(l)) }
+
 type sink struct {
 	w io.Writer
 }
 
+var (
+	dataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+	propertyEscaper = strings.NewReplacer(
+		"%", "%25",
+		"\r", "%0D",
+		"\n", "%0A",
+		":", "%3A",
+		",", "%2C",
+	)
+)
+
 func formalLevel(lvl record.Level) string {
 	switch {
 	case lvl >= record.Error:
@@ -44,31 +69,50 @@ func (s *sink) Log(r record.Record) error {
 	io.WriteString(s.w, "::")
 	io.WriteString(s.w, formalLevel(r.Level()))
 
-	initial := true
+	var (
+		initial = true
+		fields  = make(map[string]string)
+	)
 
-	if frame := stacktrace.FindCaller(2, []string{"github.com/upfluence/intenral/toolkit"}); frame != nil {
-		fmt.Fprintf(s.w, " file=%s,line=%d", filepath.Base(frame.File), frame.Line)
-		initial = false
+	for _, f := range r.Fields() {
+		switch k := f.GetKey(); k {
+		case "title", "file", "line":
+			if _, ok := fields[k]; !ok {
+				fields[k] = f.GetValue()
+			}
+		}
 	}
 
-	for _, f := range r.Fields() {
-		if f.GetKey() != "title" {
-			continue
+	if file, ok := fields["file"]; ok {
+		fmt.Fprintf(s.w, " file=%s", propertyEscaper.Replace(file))
+
+		if line, ok := fields["line"]; ok {
+			fmt.Fprintf(s.w, ",line=%s", propertyEscaper.Replace(line))
 		}
 
+		initial = false
+	} else if frame := stacktrace.FindCaller(2, []string{"github.com/upfluence/intenral/toolkit"}); frame != nil {
+		fmt.Fprintf(s.w, " file=%s,line=%d", filepath.Base(frame.File), frame.Line)
+		initial = false
+	}
+
+	if title, ok := fields["title"]; ok {
 		r := ','
 
 		if initial {
 			r = ' '
 		}
 
-		fmt.Fprintf(s.w, "%ctitle=%s", r, f.GetValue())
-
-		break
+		fmt.Fprintf(s.w, "%ctitle=%s", r, propertyEscaper.Replace(title))
 	}
 
+	var msg strings.Builder
+
+	r.WriteFormatted(&msg)
+
 	io.WriteString(s.w, "::")
-	r.WriteFormatted(s.w)
+	// a workflow command ends at the first new line
+	dataEscaper.WriteString(s.w, msg.String())
 	io.WriteString(s.w, "\n")
 
 	return nil
@@ -234,7 +278,7 @@ func newCommandContext(cctx cli.CommandContext, lc localConfig, d bool) CommandC
 type configWrapper[T any] struct {
 	Args   T           `env:"" flag:""`
 	Github localConfig `env:"GITHUB" flag:"-"`
-	Debug  bool        `env:"ACTIONS_STEP_DEBUG", flag:"-"`
+	Debug  bool        `env:"ACTIONS_STEP_DEBUG" flag:"-"`
 }
 
 func WithDefaultConfig[T any](v T) Option[T] {
@@ -19,11 +19,15 @@ func TestLogging(t *testing.T) {
 
 	l.Debug("foobar")
 	l.WithField(Title("buf")).Error("buz")
+	l.WithFields(File("pkg/foo/foo.go"), Line(12), Title("vet")).Warning("biz")
+	l.WithFields(File("pkg/foo/foo.go"), Line(3), Title("go test: a, b")).Error("--- FAIL: TestFoo\r\n    100% off\n")
 
 	assert.Equal(
 		t,
 		`::debug file=command_test.go,line=20::foobar
 ::error file=command_test.go,line=21,title=buf::buz
+::warning file=pkg/foo/foo.go,line=12,title=vet::biz
+::error file=pkg/foo/foo.go,line=3,title=go test%3A a%2C b::--- FAIL: TestFoo%0D%0A    100%25 off%0A
 `,
 		buf.String(),
 	)
@@ -9,6 +9,7 @@ import (
 	"github.com/google/go-github/v53/github"
 	"github.com/upfluence/errors"
 
+	"github.com/upfluence/actions/pkg/definitions"
 	"github.com/upfluence/actions/pkg/toolkit"
 )
 
@@ -19,8 +20,6 @@ var defaultConfig = config{
 	TargetRef:        "main",
 }
 
-type definitions map[string]map[string]any
-
 type config struct {
 	Version          string `flag:"release-version"`
 	HomebrewTap      string `flag:"homebrew-tap"`
@@ -28,6 +27,8 @@ type config struct {
 	TargetRef        string `flag:"target-ref"`
 	Template         string `flag:"template"`
 	Definitions      string `env:"DEFINITIONS"`
+
+	DefinitionsFormat definitions.Format `flag:"definitions-format"`
 }
 
 func (c config) targetRepo() (string, string) {
@@ -46,12 +47,20 @@ func main() {
 		func(ctx context.Context, cctx toolkit.CommandContext, c config) error {
 			org, repo := c.targetRepo()
 
-			var defs definitions
+			defs, err := definitions.Unmarshal([]byte(c.Definitions), "")
 
-			json.Unmarshal([]byte(c.Definitions), &defs)
+			if err != nil {
+				return err
+			}
 
-			for k, def := range defs {
-				buf, err := json.Marshal(def)
+			for _, k := range defs.Names() {
+				var buf []byte
+
+				if c.DefinitionsFormat == definitions.Legacy {
+					buf, err = json.Marshal(defs.Legacy()[k])
+				} else {
+					buf, err = defs.Filter(k).Marshal()
+				}
 
 				if err != nil {
 					return errors.Wrapf(err, "cant marshal def of %q", k)
@@ -17,17 +17,99 @@ import (
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
+	"github.com/upfluence/actions/pkg/definitions"
 	"github.com/upfluence/actions/pkg/toolkit"
 )
 
 var backoffStrategy = backoff.LimitStrategy(exponential.NewDefaultBackoff(time.Second, 15*time.Second), 5)
 
+// binary keeps .Sha256 reachable from the templates written against the
+// legacy binaries format, .Filename is provided by the artifact.
+type binary struct {
+	definitions.Artifact
+
+	Sha256 string
+}
+
+// document exposes .Sha256 the same way binary does.
+type document struct {
+	definitions.Document
+
+	Sha256 string
+}
+
 type config struct {
 	Version    string `flag:"release-version"`
 	Template   string `flag:"template"`
 	CLIName    string `flag:"cli-name"`
 	Binaries   string `env:"BINARIES"`
 	Repository string `flag:"repository"`
+
+	binaries    map[string]binary
+	completions map[completionKey]document
+	manPages    []document
+}
+
+type completionKey struct {
+	name  string
+	shell string
+}
+
+func (c config) HasBinary(target string) bool {
+	_, ok := c.binaries[target]
+	return ok
+}
+
+func (c config) Binary(target string) (binary, error) {
+	b, ok := c.binaries[target]
+
+	if !ok {
+		return b, fmt.Errorf("no binary defined for %q", target)
+	}
+
+	return b, nil
+}
+
+func (c config) HasCompletion(name, shell string) bool {
+	_, ok := c.completions[completionKey{name: name, shell: shell}]
+	return ok
+}
+
+// Completion returns the completion script of the executable generated for
+// the shell, bash, zsh or fish.
+func (c config) Completion(name, shell string) (document, error) {
+	d, ok := c.completions[completionKey{name: name, shell: shell}]
+
+	if !ok {
+		return d, fmt.Errorf("no %s completion defined for %q", shell, name)
+	}
+
+	return d, nil
+}
+
+func (c config) ManPages() []document {
+	return c.manPages
+}
+
+func (c *config) load(defs definitions.Definitions) {
+	c.binaries = make(map[string]binary, len(defs.Artifacts))
+
+	for _, a := range defs.Artifacts {
+		c.binaries[a.Target()] = binary{Artifact: a, Sha256: a.Checksums.SHA256}
+	}
+
+	c.completions = make(map[completionKey]document)
+
+	for _, d := range defs.Documents {
+		doc := document{Document: d, Sha256: d.Checksums.SHA256}
+
+		switch d.Kind {
+		case definitions.Completion:
+			c.completions[completionKey{name: d.Name, shell: d.Shell}] = doc
+		case definitions.ManPage:
+			c.manPages = append(c.manPages, doc)
+		}
+	}
 }
 
 func camelCase(v string) string {
@@ -46,6 +128,16 @@ func main() {
 		func(ctx context.Context, cctx toolkit.CommandContext, c config) error {
 			c.Version = strings.TrimPrefix(c.Version, "v")
 
+			if c.Binaries != "" {
+				defs, err := definitions.Unmarshal([]byte(c.Binaries), c.CLIName)
+
+				if err != nil {
+					return errors.Wrap(err, "cant decode binaries")
+				}
+
+				c.load(defs)
+			}
+
 			t := template.New("").Funcs(template.FuncMap{"camelCase": camelCase})
 
 			t, err := t.ParseFiles(c.Template)
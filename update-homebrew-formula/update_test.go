@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upfluence/actions/pkg/definitions"
+)
+
+func TestConfigCompletions(t *testing.T) {
+	var c config
+
+	c.load(
+		definitions.Definitions{
+			Documents: []definitions.Document{
+				{
+					Name:      "foo",
+					Kind:      definitions.Completion,
+					Shell:     "zsh",
+					Path:      "completions/foo.zsh",
+					Checksums: definitions.Checksums{SHA256: "foo-zsh"},
+				},
+				{
+					Name:      "bar",
+					Kind:      definitions.Completion,
+					Shell:     "zsh",
+					Path:      "completions/bar.zsh",
+					Checksums: definitions.Checksums{SHA256: "bar-zsh"},
+				},
+				{
+					Name:      "bar",
+					Kind:      definitions.Completion,
+					Shell:     "bash",
+					Path:      "completions/bar.bash",
+					Checksums: definitions.Checksums{SHA256: "bar-bash"},
+				},
+				{Name: "foo", Kind: definitions.ManPage, Section: 1, Path: "man/foo.1"},
+			},
+		},
+	)
+
+	tmpl := template.Must(
+		template.New("").Parse(
+			`{{ (.Completion "foo" "zsh").Sha256 }} {{ (.Completion "bar" "zsh").Filename }} ` +
+				`{{ .HasCompletion "foo" "bash" }} {{ .HasCompletion "bar" "bash" }} {{ len .ManPages }}`,
+		),
+	)
+
+	var buf strings.Builder
+
+	require.NoError(t, tmpl.Execute(&buf, c))
+	assert.Equal(t, "foo-zsh bar.zsh false true 1", buf.String())
+
+	_, err := c.Completion("foo", "fish")
+	assert.EqualError(t, err, `no fish completion defined for "foo"`)
+}